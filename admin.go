@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	actorAPIKey = "api_key"
+	actorUser = "user"
+)
+
+// adminActor is who performed an admin action: the holder of the ADMIN_KEY,
+// or a user with the admin scope.
+type adminActor struct {
+	Kind	string
+	UserID	uuid.NullUUID
+}
+
+type adminActorKey struct{}
+
+func withAdminActor(r *http.Request, actor adminActor) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), adminActorKey{}, actor))
+}
+
+func adminActorFromRequest(r *http.Request) adminActor {
+	actor, _ := r.Context().Value(adminActorKey{}).(adminActor)
+	return actor
+}
+
+// recordAudit writes an admin action to the audit log. Every admin action
+// must be audited, so handlers record the action before making the change
+// and give up with a 5xx when this fails. An action that then fails to apply
+// stays in the log as an attempt.
+func recordAudit(ctx context.Context, r *http.Request, cfg *apiConfig, action, targetType, targetID string, details any) error {
+	ctx, cancel := detachedContext(ctx)
+	defer cancel()
+	actor := adminActorFromRequest(r)
+	data := []byte("{}")
+	if details != nil {
+		var err error
+		data, err = json.Marshal(details)
+		if err != nil {
+			return fmt.Errorf("marshal audit details for %s: %w", action, err)
+		}
+	}
+	params := database.CreateAuditLogEntryParams{
+		ActorUserID: actor.UserID,
+		Actor: actor.Kind,
+		Action: action,
+		TargetType: targetType,
+		TargetID: targetID,
+		Details: data,
+	}
+	if err := cfg.dbQueries.CreateAuditLogEntry(ctx, params); err != nil {
+		return fmt.Errorf("record audit entry for %s: %w", action, err)
+	}
+	return nil
+}
+
+type adminUserResponse struct {
+	ID			uuid.UUID	`json:"id"`
+	Email		string		`json:"email"`
+	CreatedAt	time.Time	`json:"created_at"`
+	UpdatedAt	time.Time	`json:"updated_at"`
+	IsChirpyRed	bool		`json:"is_chirpy_red"`
+	EmailVerified	bool	`json:"email_verified"`
+	Role		string		`json:"role"`
+	DisabledAt	*time.Time	`json:"disabled_at"`
+}
+
+func newAdminUserResponse(user database.User) adminUserResponse {
+	res := adminUserResponse{
+		ID: user.ID,
+		Email: user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		IsChirpyRed: user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Role: user.Role,
+	}
+	if user.DisabledAt.Valid {
+		res.DisabledAt = &user.DisabledAt.Time
+	}
+	return res
+}
+
+func respondWithAdminUser(w http.ResponseWriter, user database.User) {
+	res := newAdminUserResponse(user)
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// HandlerAdminListUsers lists users newest first. The optional q parameter
+// keeps users whose email contains it, ignoring case.
+func HandlerAdminListUsers(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type response struct {
+		Users		[]adminUserResponse	`json:"users"`
+		NextCursor	string				`json:"next_cursor,omitempty"`
+	}
+	query := r.URL.Query()
+	page, err := parseNewestFirstPage(query)
+	if err != nil {
+		respondWithError(w, 400, codeInvalidQuery, err.Error(), err)
+		return
+	}
+	params := database.ListUsersParams{
+		Limit: int32(page.Limit + 1),
+	}
+	if q := query.Get("q"); q != "" {
+		params.Email = sql.NullString{String: q, Valid: true}
+	}
+	params.CursorCreatedAt, params.CursorID = keysetArgs(page.Cursor)
+	users, err := cfg.dbQueries.ListUsers(r.Context(), params)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	res := response{Users: []adminUserResponse{}}
+	if len(users) > page.Limit {
+		users = users[:page.Limit]
+		last := users[len(users)-1]
+		res.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, user := range users {
+		res.Users = append(res.Users, newAdminUserResponse(user))
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// HandlerAdminDisableUser blocks a user from logging in and revokes their
+// refresh tokens. Access tokens already issued are refused from then on by
+// checkTokenUser.
+func HandlerAdminDisableUser(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	user_id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 404, codeUserNotFound, "user not found", err)
+		return
+	}
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByID(ctx, user_id)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	if err := recordAudit(ctx, r, cfg, "user.disable", "user", user.ID.String(), nil); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	user, err = cfg.dbQueries.DisableUser(ctx, user.ID)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	if err := cfg.dbQueries.RevokeUserTokens(ctx, user.ID); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	respondWithAdminUser(w, user)
+}
+
+func HandlerAdminEnableUser(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	user_id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 404, codeUserNotFound, "user not found", err)
+		return
+	}
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByID(ctx, user_id)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	if err := recordAudit(ctx, r, cfg, "user.enable", "user", user.ID.String(), nil); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	user, err = cfg.dbQueries.EnableUser(ctx, user.ID)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	respondWithAdminUser(w, user)
+}
+
+func HandlerAdminRevokeUserTokens(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	user_id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 404, codeUserNotFound, "user not found", err)
+		return
+	}
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByID(ctx, user_id)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	if err := recordAudit(ctx, r, cfg, "user.revoke_tokens", "user", user.ID.String(), nil); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if err := cfg.dbQueries.RevokeUserTokens(ctx, user.ID); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func HandlerAdminSetChirpyRed(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type request struct {
+		IsChirpyRed	bool	`json:"is_chirpy_red"`
+	}
+	user_id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 404, codeUserNotFound, "user not found", err)
+		return
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByID(ctx, user_id)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	if err := recordAudit(ctx, r, cfg, "user.set_chirpy_red", "user", user.ID.String(), req); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	params := database.SetChirpyRedParams{
+		ID: user.ID,
+		IsChirpyRed: req.IsChirpyRed,
+	}
+	user, err = cfg.dbQueries.SetChirpyRed(ctx, params)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	respondWithAdminUser(w, user)
+}
+
+// HandlerAdminDeleteChirp deletes any user's chirp, with the same tombstone
+// rule as HandlerDeleteChirp.
+func HandlerAdminDeleteChirp(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	chirp_id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", err)
+		return
+	}
+	ctx := r.Context()
+	chirp, err := cfg.dbQueries.GetChirp(ctx, chirp_id)
+	if err != nil {
+		respondWithLookupError(w, err, codeChirpNotFound, "chirp not found")
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", nil)
+		return
+	}
+	details := map[string]any{"user_id": chirp.UserID, "body": chirp.Body}
+	if err := recordAudit(ctx, r, cfg, "chirp.delete", "chirp", chirp.ID.String(), details); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if err := removeChirp(ctx, cfg, chirp); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func HandlerAdminListAuditLog(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type entry struct {
+		ID			uuid.UUID		`json:"id"`
+		CreatedAt	time.Time		`json:"created_at"`
+		Actor		string			`json:"actor"`
+		ActorUserID	*uuid.UUID		`json:"actor_user_id"`
+		Action		string			`json:"action"`
+		TargetType	string			`json:"target_type"`
+		TargetID	string			`json:"target_id"`
+		Details		json.RawMessage	`json:"details"`
+	}
+	type response struct {
+		Entries		[]entry	`json:"entries"`
+		NextCursor	string	`json:"next_cursor,omitempty"`
+	}
+	page, err := parseNewestFirstPage(r.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, codeInvalidQuery, err.Error(), err)
+		return
+	}
+	params := database.ListAuditLogParams{
+		Limit: int32(page.Limit + 1),
+	}
+	params.CursorCreatedAt, params.CursorID = keysetArgs(page.Cursor)
+	entries, err := cfg.dbQueries.ListAuditLog(r.Context(), params)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	res := response{Entries: []entry{}}
+	if len(entries) > page.Limit {
+		entries = entries[:page.Limit]
+		last := entries[len(entries)-1]
+		res.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, e := range entries {
+		item := entry{
+			ID: e.ID,
+			CreatedAt: e.CreatedAt,
+			Actor: e.Actor,
+			Action: e.Action,
+			TargetType: e.TargetType,
+			TargetID: e.TargetID,
+			Details: e.Details,
+		}
+		if e.ActorUserID.Valid {
+			item.ActorUserID = &e.ActorUserID.UUID
+		}
+		res.Entries = append(res.Entries, item)
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/IArtMediums/chirp_project/internal/auth"
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/IArtMediums/chirp_project/internal/logging"
+	"github.com/IArtMediums/chirp_project/internal/mail"
+	"github.com/google/uuid"
+)
+
+const (
+	emailTokenVerify = "verify_email"
+	emailTokenPasswordReset = "password_reset"
+)
+
+const verifyEmailTTLMinutes = 24 * 60
+const passwordResetTTLMinutes = 60
+
+// sendEmailToken issues a new purpose token for the user's current address and
+// mails it. Earlier unused tokens for the same purpose stop working, so only
+// the most recent email is valid.
+func sendEmailToken(ctx context.Context, cfg *apiConfig, userID uuid.UUID, email, purpose string) error {
+	invalidate := database.InvalidateEmailTokensParams{
+		UserID: userID,
+		Purpose: purpose,
+	}
+	if err := cfg.dbQueries.InvalidateEmailTokens(ctx, invalidate); err != nil {
+		return err
+	}
+	token, hash := auth.MakeEmailToken()
+	msg := mail.Message{To: email}
+	params := database.CreateEmailTokenParams{
+		TokenHash: hash,
+		UserID: userID,
+		Email: email,
+		Purpose: purpose,
+	}
+	switch purpose {
+	case emailTokenVerify:
+		params.TtlMinutes = verifyEmailTTLMinutes
+		msg.Subject = "Confirm your Chirpy email address"
+		msg.Body = fmt.Sprintf("Confirm your email address with this token:\n\n    %s\n\nSend it to POST /api/verify-email. It expires in 24 hours.\n", token)
+	case emailTokenPasswordReset:
+		params.TtlMinutes = passwordResetTTLMinutes
+		msg.Subject = "Reset your Chirpy password"
+		msg.Body = fmt.Sprintf("Someone asked to reset the password for this address. If it was you, use this token:\n\n    %s\n\nSend it with your new password to POST /api/password-reset/confirm. It expires in 1 hour. If it was not you, ignore this email.\n", token)
+	default:
+		return fmt.Errorf("unknown email token purpose %q", purpose)
+	}
+	if err := cfg.dbQueries.CreateEmailToken(ctx, params); err != nil {
+		return err
+	}
+	return cfg.mailer.Send(ctx, msg)
+}
+
+func HandlerVerifyEmail(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type request struct {
+		Token	string	`json:"token"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	ctx := r.Context()
+	params := database.ConsumeEmailTokenParams{
+		TokenHash: auth.HashEmailToken(req.Token),
+		Purpose: emailTokenVerify,
+	}
+	token, err := cfg.dbQueries.ConsumeEmailToken(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 400, codeInvalidEmailToken, "token is invalid, expired or already used", err)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	verify := database.VerifyUserEmailParams{
+		ID: token.UserID,
+		Email: token.Email,
+	}
+	verified, err := cfg.dbQueries.VerifyUserEmail(ctx, verify)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	// The user changed their email after the token was sent.
+	if verified == 0 {
+		respondWithError(w, 400, codeInvalidEmailToken, "token is invalid, expired or already used", nil)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// HandlerResendVerification and HandlerRequestPasswordReset answer 202
+// whether or not the email belongs to an account, so they cannot be used to
+// find out which addresses are registered.
+func HandlerResendVerification(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type request struct {
+		Email	string	`json:"email"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByEmail(ctx, req.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithInternalError(w, err)
+		return
+	}
+	if err == nil && !user.EmailVerifiedAt.Valid {
+		if err := sendEmailToken(ctx, cfg, user.ID, user.Email, emailTokenVerify); err != nil {
+			respondWithInternalError(w, err)
+			return
+		}
+	}
+	w.WriteHeader(202)
+}
+
+func HandlerRequestPasswordReset(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type request struct {
+		Email	string	`json:"email"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByEmail(ctx, req.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithInternalError(w, err)
+		return
+	}
+	if err == nil {
+		if err := sendEmailToken(ctx, cfg, user.ID, user.Email, emailTokenPasswordReset); err != nil {
+			respondWithInternalError(w, err)
+			return
+		}
+	}
+	w.WriteHeader(202)
+}
+
+// HandlerConfirmPasswordReset sets a new password, logs the user out
+// everywhere and lifts any login lockout on the account. Receiving the email
+// proves control of the address, so it also counts as verifying it.
+func HandlerConfirmPasswordReset(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type request struct {
+		Token		string	`json:"token"`
+		Password	string	`json:"password"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Password == "" {
+		respondWithError(w, 400, codeInvalidPassword, "password must not be empty", nil)
+		return
+	}
+	ctx := r.Context()
+	params := database.ConsumeEmailTokenParams{
+		TokenHash: auth.HashEmailToken(req.Token),
+		Purpose: emailTokenPasswordReset,
+	}
+	token, err := cfg.dbQueries.ConsumeEmailToken(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 400, codeInvalidEmailToken, "token is invalid, expired or already used", err)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	reset := database.ResetUserPasswordParams{
+		ID: token.UserID,
+		Email: token.Email,
+		HashedPassword: hash,
+	}
+	updated, err := cfg.dbQueries.ResetUserPassword(ctx, reset)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if updated == 0 {
+		respondWithError(w, 400, codeInvalidEmailToken, "token is invalid, expired or already used", nil)
+		return
+	}
+	if err := cfg.dbQueries.RevokeUserTokens(ctx, token.UserID); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if err := clearAccountLock(ctx, cfg, token.Email); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// sendVerificationEmail is sendEmailToken for handlers that have already
+// succeeded; a failed send is logged and the user can ask for a new email.
+func sendVerificationEmail(ctx context.Context, cfg *apiConfig, userID uuid.UUID, email string) {
+	ctx, cancel := detachedContext(ctx)
+	defer cancel()
+	if err := sendEmailToken(ctx, cfg, userID, email, emailTokenVerify); err != nil {
+		logging.FromContext(ctx).Error("send verification email", "user_id", userID, "error", err)
+	}
+}
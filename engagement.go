@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+func HandlerLikeChirp(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	chirpID, ok := engagementTarget(w, r, cfg)
+	if !ok {
+		return
+	}
+	params := database.LikeChirpParams{
+		UserID: id,
+		ChirpID: chirpID,
+	}
+	if err := cfg.dbQueries.LikeChirp(r.Context(), params); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func HandlerUnlikeChirp(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	chirpID, ok := engagementTarget(w, r, cfg)
+	if !ok {
+		return
+	}
+	params := database.UnlikeChirpParams{
+		UserID: id,
+		ChirpID: chirpID,
+	}
+	if err := cfg.dbQueries.UnlikeChirp(r.Context(), params); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func HandlerRechirp(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	chirpID, ok := engagementTarget(w, r, cfg)
+	if !ok {
+		return
+	}
+	params := database.RechirpChirpParams{
+		UserID: id,
+		ChirpID: chirpID,
+	}
+	if err := cfg.dbQueries.RechirpChirp(r.Context(), params); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// engagementTarget resolves the {chirpID} path value, writing 404 unless it
+// names a chirp that has not been deleted.
+func engagementTarget(w http.ResponseWriter, r *http.Request, cfg *apiConfig) (uuid.UUID, bool) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", err)
+		return uuid.Nil, false
+	}
+	chirp, err := cfg.dbQueries.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithLookupError(w, err, codeChirpNotFound, "chirp not found")
+		return uuid.Nil, false
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", nil)
+		return uuid.Nil, false
+	}
+	return chirpID, true
+}
+
+// markLikedByMe fills in LikedByMe on chirps for the given viewer. Anonymous
+// viewers (uuid.Nil) are left untouched so the field is omitted.
+func markLikedByMe(ctx context.Context, cfg *apiConfig, viewer uuid.UUID, chirps []chirpResponse) error {
+	if viewer == uuid.Nil || len(chirps) == 0 {
+		return nil
+	}
+	ids := []uuid.UUID{}
+	for _, c := range chirps {
+		ids = append(ids, c.ID)
+	}
+	liked, err := cfg.dbQueries.ListLikedChirpIDs(ctx, database.ListLikedChirpIDsParams{
+		UserID: viewer,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+	likedSet := map[uuid.UUID]struct{}{}
+	for _, id := range liked {
+		likedSet[id] = struct{}{}
+	}
+	for i := range chirps {
+		_, ok := likedSet[chirps[i].ID]
+		chirps[i].LikedByMe = &ok
+	}
+	return nil
+}
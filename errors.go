@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// errorCode is the machine-readable part of an error response. Codes are part
+// of the API contract: clients match on them, so existing values must not
+// change.
+type errorCode string
+
+const (
+	codeInternal			errorCode = "internal_error"
+	codeTimeout				errorCode = "timeout"
+	codeUnavailable			errorCode = "service_unavailable"
+	codeRequestCanceled		errorCode = "request_canceled"
+	codeInvalidJSON			errorCode = "invalid_json"
+	codeInvalidQuery		errorCode = "invalid_query"
+	codeMissingAuth			errorCode = "missing_authorization"
+	codeInvalidToken		errorCode = "invalid_token"
+	codeInvalidRefreshToken	errorCode = "invalid_refresh_token"
+	codeRefreshTokenReused	errorCode = "refresh_token_reused"
+	codeInvalidAPIKey		errorCode = "invalid_api_key"
+	codeInvalidCredentials	errorCode = "invalid_credentials"
+	codeAccountDisabled		errorCode = "account_disabled"
+	codeEmailNotVerified	errorCode = "email_not_verified"
+	codeInvalidEmailToken	errorCode = "invalid_email_token"
+	codeInvalidPassword		errorCode = "invalid_password"
+	codeLoginLocked			errorCode = "login_locked"
+	codeRateLimited			errorCode = "rate_limited"
+	codeInvalidChallenge	errorCode = "invalid_challenge"
+	codeInvalidTwoFactorCode	errorCode = "invalid_two_factor_code"
+	codeTwoFactorEnabled	errorCode = "two_factor_enabled"
+	codeTwoFactorNotSetUp	errorCode = "two_factor_not_set_up"
+	codeForbidden			errorCode = "forbidden"
+	codeInsufficientScope	errorCode = "insufficient_scope"
+	codeInvalidRole			errorCode = "invalid_role"
+	codeUserNotFound		errorCode = "user_not_found"
+	codeEmailTaken			errorCode = "email_taken"
+	codeChirpNotFound		errorCode = "chirp_not_found"
+	codeNotOwner			errorCode = "not_owner"
+	codeChirpTooLong		errorCode = "chirp_too_long"
+	codeChirpRejected		errorCode = "chirp_rejected"
+	codeInvalidReplyTo		errorCode = "invalid_reply_to"
+	codeSelfFollow			errorCode = "self_follow"
+	codeInvalidWord			errorCode = "invalid_word"
+	codeSessionNotFound		errorCode = "session_not_found"
+)
+
+type errorBody struct {
+	Code	errorCode	`json:"code"`
+	Message	string		`json:"message"`
+}
+
+type errorResponse struct {
+	Error	errorBody	`json:"error"`
+}
+
+// respondWithError records err, if any, for the request log and writes status with a body of the
+// form {"error": {"code": ..., "message": ...}}. message is shown to clients,
+// so it must not include err's text unless that text is safe to expose.
+func respondWithError(w http.ResponseWriter, status int, code errorCode, message string, err error) {
+	if err != nil && !recordResponseError(w, err) {
+		slog.Error("request failed", "error", err)
+	}
+	data, err := json.Marshal(&errorResponse{Error: errorBody{Code: code, Message: message}})
+	if err != nil {
+		slog.Error("marshal error response", "error", err)
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// statusClientClosedRequest is nginx's status for a client that hung up
+// before the response was ready. The client never sees it; it keeps such
+// requests apart from real failures in logs and metrics.
+const statusClientClosedRequest = 499
+
+// respondWithInternalError hides err from the client behind a generic 500,
+// unless the database ran out of time (504) or could not be reached (503).
+func respondWithInternalError(w http.ResponseWriter, err error) {
+	switch {
+	case isTimeout(err):
+		respondWithError(w, 504, codeTimeout, "the request took too long, try again later", err)
+	case isUnavailable(err):
+		w.Header().Set("Retry-After", "5")
+		respondWithError(w, 503, codeUnavailable, "the service is temporarily unavailable, try again later", err)
+	case errors.Is(err, context.Canceled):
+		respondWithError(w, statusClientClosedRequest, codeRequestCanceled, "request canceled", err)
+	default:
+		respondWithError(w, 500, codeInternal, "internal server error", err)
+	}
+}
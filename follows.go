@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+func HandlerFollowUser(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	followee, ok := followTarget(w, r, cfg, id)
+	if !ok {
+		return
+	}
+	params := database.FollowUserParams{
+		FollowerID: id,
+		FolloweeID: followee,
+	}
+	if err := cfg.dbQueries.FollowUser(r.Context(), params); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func HandlerUnfollowUser(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	followee, ok := followTarget(w, r, cfg, id)
+	if !ok {
+		return
+	}
+	params := database.UnfollowUserParams{
+		FollowerID: id,
+		FolloweeID: followee,
+	}
+	if err := cfg.dbQueries.UnfollowUser(r.Context(), params); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// followTarget resolves the {userID} path value for follow/unfollow, writing
+// 400 for self-follows and 404 for unknown users.
+func followTarget(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) (uuid.UUID, bool) {
+	followee, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 404, codeUserNotFound, "user not found", err)
+		return uuid.Nil, false
+	}
+	if followee == id {
+		respondWithError(w, 400, codeSelfFollow, "users cannot follow themselves", nil)
+		return uuid.Nil, false
+	}
+	if _, err := cfg.dbQueries.GetUserByID(r.Context(), followee); err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return uuid.Nil, false
+	}
+	return followee, true
+}
+
+type followEntry struct {
+	UserID		uuid.UUID	`json:"user_id"`
+	FollowedAt	time.Time	`json:"followed_at"`
+}
+
+type followPage struct {
+	Users		[]followEntry	`json:"users"`
+	NextCursor	string			`json:"next_cursor,omitempty"`
+}
+
+func HandlerGetFollowers(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	userID, page, ok := followListParams(w, r)
+	if !ok {
+		return
+	}
+	params := database.ListFollowersParams{
+		UserID: userID,
+		Limit: int32(page.Limit + 1),
+	}
+	params.CursorCreatedAt, params.CursorID = keysetArgs(page.Cursor)
+	rows, err := cfg.dbQueries.ListFollowers(r.Context(), params)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	entries := []followEntry{}
+	for _, row := range rows {
+		entries = append(entries, followEntry{UserID: row.FollowerID, FollowedAt: row.CreatedAt})
+	}
+	writeFollowPage(w, entries, page.Limit)
+}
+
+func HandlerGetFollowing(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	userID, page, ok := followListParams(w, r)
+	if !ok {
+		return
+	}
+	params := database.ListFollowingParams{
+		UserID: userID,
+		Limit: int32(page.Limit + 1),
+	}
+	params.CursorCreatedAt, params.CursorID = keysetArgs(page.Cursor)
+	rows, err := cfg.dbQueries.ListFollowing(r.Context(), params)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	entries := []followEntry{}
+	for _, row := range rows {
+		entries = append(entries, followEntry{UserID: row.FolloweeID, FollowedAt: row.CreatedAt})
+	}
+	writeFollowPage(w, entries, page.Limit)
+}
+
+func followListParams(w http.ResponseWriter, r *http.Request) (uuid.UUID, pageParams, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 404, codeUserNotFound, "user not found", err)
+		return uuid.Nil, pageParams{}, false
+	}
+	page, err := parseNewestFirstPage(r.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, codeInvalidQuery, err.Error(), err)
+		return uuid.Nil, pageParams{}, false
+	}
+	return userID, page, true
+}
+
+// writeFollowPage trims the extra look-ahead row fetched to detect a next
+// page and writes the response.
+func writeFollowPage(w http.ResponseWriter, entries []followEntry, limit int) {
+	res := followPage{Users: entries}
+	if len(entries) > limit {
+		res.Users = entries[:limit]
+		last := res.Users[len(res.Users)-1]
+		res.NextCursor = encodeCursor(last.FollowedAt, last.UserID)
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+func HandlerGetTimeline(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	type response struct {
+		Chirps		[]chirpResponse	`json:"chirps"`
+		NextCursor	string			`json:"next_cursor,omitempty"`
+	}
+	page, err := parseNewestFirstPage(r.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, codeInvalidQuery, err.Error(), err)
+		return
+	}
+	params := database.ListTimelineParams{
+		UserID: id,
+		Limit: int32(page.Limit + 1),
+	}
+	params.CursorCreatedAt, params.CursorID = keysetArgs(page.Cursor)
+	chirps, err := cfg.dbQueries.ListTimeline(r.Context(), params)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	res := response{Chirps: []chirpResponse{}}
+	if len(chirps) > page.Limit {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		res.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, c := range chirps {
+		res.Chirps = append(res.Chirps, newChirpResponse(c))
+	}
+	if err := markLikedByMe(r.Context(), cfg, id, res.Chirps); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
@@ -1,7 +1,6 @@
 package auth
 import (
 	"github.com/alexedwards/argon2id"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"time"
 	"fmt"
@@ -21,36 +20,14 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return match, err
 }
 
+// MakeJWT signs an HS256 user token with a shared secret. Servers with a key
+// set use KeySet.MakeJWT instead.
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer: "chirpy-access",
-		IssuedAt: jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject: userID.String(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	ss, err := token.SignedString([]byte(tokenSecret))
-	return ss, err
+	return NewHMACKeySet(tokenSecret).MakeJWT(userID, RoleUser, expiresIn)
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
-		if token.Method != jwt.SigningMethodHS256 {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return uuid.Nil, err
-	} else if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok {
-		id, err := uuid.Parse(claims.Subject)
-		if err != nil {
-			return uuid.Nil, err
-		}
-		return id, nil
-	} else {
-		return uuid.Nil, fmt.Errorf("unknown claims type, cannot proceed")
-	}
+	return NewHMACKeySet(tokenSecret).ValidateJWT(tokenString)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// MakeEmailToken returns a random single-use token to send by email and the
+// hash to store in its place, so a leaked table cannot be replayed.
+func MakeEmailToken() (token, hash string) {
+	token = MakeRefreshToken()
+	return token, HashEmailToken(token)
+}
+
+func HashEmailToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
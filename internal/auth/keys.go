@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// minRSABits is the smallest RSA modulus LoadKeySet accepts.
+const minRSABits = 2048
+
+// key is one entry of a KeySet. private is nil for keys that are only kept
+// to verify tokens signed before a rotation.
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private any
+	public  any
+}
+
+// KeySet signs access tokens with one key and validates them against every
+// key it holds, looked up by the token's kid header. Rotating keys means
+// adding a new key, making it the signing key, and removing the old one once
+// the tokens it signed have expired.
+type KeySet struct {
+	signing *key
+	keys    map[string]*key
+}
+
+// NewHMACKeySet returns a KeySet that signs and validates HS256 tokens with a
+// shared secret. Its tokens carry no kid and it publishes no keys.
+func NewHMACKeySet(secret string) *KeySet {
+	k := &key{method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+	return &KeySet{signing: k, keys: map[string]*key{"": k}}
+}
+
+// LoadKeySet reads every *.pem file in dir. The file name without its
+// extension is the key's kid. A file may hold an RSA or Ed25519 private key
+// (PKCS#8, or PKCS#1 for RSA), which can sign, or a PKIX public key, which
+// only validates. RSA keys sign with RS256 and Ed25519 keys with EdDSA.
+//
+// signingKID picks the signing key. It may be empty when dir holds exactly
+// one private key.
+func LoadKeySet(dir, signingKID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	set := &KeySet{keys: map[string]*key{}}
+	var private []*key
+	for _, path := range paths {
+		k, err := loadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		set.keys[k.id] = k
+		if k.private != nil {
+			private = append(private, k)
+		}
+	}
+	if len(set.keys) == 0 {
+		return nil, fmt.Errorf("no *.pem keys in %s", dir)
+	}
+	switch {
+	case signingKID != "":
+		k, ok := set.keys[signingKID]
+		if !ok {
+			return nil, fmt.Errorf("signing key %q not found in %s", signingKID, dir)
+		}
+		if k.private == nil {
+			return nil, fmt.Errorf("signing key %q is a public key", signingKID)
+		}
+		set.signing = k
+	case len(private) == 1:
+		set.signing = private[0]
+	case len(private) == 0:
+		return nil, fmt.Errorf("no private keys in %s", dir)
+	default:
+		return nil, fmt.Errorf("%d private keys in %s; choose one to sign with", len(private), dir)
+	}
+	return set, nil
+}
+
+func loadKey(path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	k := &key{id: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	switch block.Type {
+	case "PRIVATE KEY":
+		k.private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		k.private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		k.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	switch priv := k.private.(type) {
+	case *rsa.PrivateKey:
+		k.public = &priv.PublicKey
+	case ed25519.PrivateKey:
+		k.public = priv.Public()
+	case nil:
+	default:
+		return nil, fmt.Errorf("%s: unsupported private key type %T", path, priv)
+	}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%s: RSA key is %d bits, need at least %d", path, pub.N.BitLen(), minRSABits)
+		}
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%s: unsupported public key type %T", path, pub)
+	}
+	return k, nil
+}
+
+// SigningKeyID returns the kid new tokens are signed with.
+func (s *KeySet) SigningKeyID() string {
+	return s.signing.id
+}
+
+// MakeJWT issues an access token for userID carrying role and the scopes it
+// grants.
+func (s *KeySet) MakeJWT(userID uuid.UUID, role Role, expiresIn time.Duration) (string, error) {
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy-access",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Role:  role,
+		Scope: strings.Join(ScopesForRole(role), " "),
+	}
+	token := jwt.NewWithClaims(s.signing.method, claims)
+	if s.signing.id != "" {
+		token.Header["kid"] = s.signing.id
+	}
+	return token.SignedString(s.signing.private)
+}
+
+// ParseJWT verifies an access token and returns its claims. Tokens issued
+// before roles existed carry neither role nor scope; they are read as plain
+// user tokens.
+func (s *KeySet) ParseJWT(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok {
+		return nil, fmt.Errorf("unknown claims type, cannot proceed")
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, err
+	}
+	if claims.Role == "" && claims.Scope == "" {
+		claims.Role = RoleUser
+		claims.Scope = strings.Join(ScopesForRole(RoleUser), " ")
+	}
+	return claims, nil
+}
+
+func (s *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := s.ParseJWT(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID()
+}
+
+// keyFunc finds the key named by the token's kid and insists the token uses
+// that key's algorithm, so a public key can never be used as an HMAC secret.
+func (s *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return k.public, nil
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key, sorted by kid. HMAC
+// secrets are never published.
+func (s *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range s.keys {
+		jwk, ok := k.jwk()
+		if !ok {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+	return set
+}
+
+func (k *key) jwk() (JWK, bool) {
+	enc := base64.RawURLEncoding
+	jwk := JWK{KeyID: k.id, Use: "sig", Algorithm: k.method.Alg()}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = enc.EncodeToString(pub.N.Bytes())
+		jwk.E = enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = enc.EncodeToString(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
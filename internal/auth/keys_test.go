@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writePEM(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+}
+
+func writeEd25519Key(t *testing.T, dir, kid string) ed25519.PrivateKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey returned error: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey returned error: %v", err)
+	}
+	writePEM(t, dir, kid, "PRIVATE KEY", der)
+	return priv
+}
+
+func writeRSAKey(t *testing.T, dir, kid string, bits int) *rsa.PrivateKey {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("GenerateKey returned error: %v", err)
+	}
+	writePEM(t, dir, kid, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv))
+	return priv
+}
+
+func TestKeySet_SignAndValidate(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "ed-1")
+	writeRSAKey(t, dir, "rsa-1", 2048)
+
+	for _, kid := range []string{"ed-1", "rsa-1"} {
+		keys, err := LoadKeySet(dir, kid)
+		if err != nil {
+			t.Fatalf("LoadKeySet returned error: %v", err)
+		}
+		userID := uuid.New()
+		token, err := keys.MakeJWT(userID, RoleUser, time.Minute)
+		if err != nil {
+			t.Fatalf("MakeJWT returned error: %v", err)
+		}
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+		if err != nil {
+			t.Fatalf("ParseUnverified returned error: %v", err)
+		}
+		if parsed.Header["kid"] != kid {
+			t.Fatalf("expected kid %q, got %v", kid, parsed.Header["kid"])
+		}
+		gotID, err := keys.ValidateJWT(token)
+		if err != nil {
+			t.Fatalf("ValidateJWT returned error: %v", err)
+		}
+		if gotID != userID {
+			t.Fatalf("expected userID %v, got %v", userID, gotID)
+		}
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "2026-01")
+	before, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet returned error: %v", err)
+	}
+	oldToken, err := before.MakeJWT(uuid.New(), RoleUser, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+
+	// With two private keys the signing key must be named.
+	writeEd25519Key(t, dir, "2026-02")
+	if _, err := LoadKeySet(dir, ""); err == nil {
+		t.Fatalf("expected error without a signing key id, got nil")
+	}
+	after, err := LoadKeySet(dir, "2026-02")
+	if err != nil {
+		t.Fatalf("LoadKeySet returned error: %v", err)
+	}
+	if _, err := after.ValidateJWT(oldToken); err != nil {
+		t.Fatalf("old token should still validate after rotation: %v", err)
+	}
+
+	// Retiring the old key invalidates what it signed.
+	if err := os.Remove(filepath.Join(dir, "2026-01.pem")); err != nil {
+		t.Fatalf("remove key: %v", err)
+	}
+	retired, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet returned error: %v", err)
+	}
+	if _, err := retired.ValidateJWT(oldToken); err == nil {
+		t.Fatalf("expected error for token signed by a removed key, got nil")
+	}
+}
+
+func TestKeySet_PublicKeyOnlyValidates(t *testing.T) {
+	dir := t.TempDir()
+	priv := writeEd25519Key(t, dir, "old")
+	signer, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet returned error: %v", err)
+	}
+	token, err := signer.MakeJWT(uuid.New(), RoleUser, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey returned error: %v", err)
+	}
+	writePEM(t, dir, "old", "PUBLIC KEY", der)
+	if _, err := LoadKeySet(dir, "old"); err == nil {
+		t.Fatalf("expected error signing with a public key, got nil")
+	}
+	writeEd25519Key(t, dir, "new")
+	keys, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet returned error: %v", err)
+	}
+	if keys.SigningKeyID() != "new" {
+		t.Fatalf("expected signing key %q, got %q", "new", keys.SigningKeyID())
+	}
+	if _, err := keys.ValidateJWT(token); err != nil {
+		t.Fatalf("token should validate against the public key: %v", err)
+	}
+}
+
+func TestKeySet_RejectsWeakRSAKey(t *testing.T) {
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "weak", 1024)
+	if _, err := LoadKeySet(dir, ""); err == nil {
+		t.Fatalf("expected error for 1024-bit RSA key, got nil")
+	}
+}
+
+func TestKeySet_RejectsHMACWithPublicKey(t *testing.T) {
+	dir := t.TempDir()
+	priv := writeEd25519Key(t, dir, "ed")
+	keys, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet returned error: %v", err)
+	}
+
+	// The classic algorithm confusion attack: sign HS256 with the public key.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		Subject:   uuid.New().String(),
+	})
+	token.Header["kid"] = "ed"
+	signed, err := token.SignedString([]byte(priv.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatalf("SignedString returned error: %v", err)
+	}
+	if _, err := keys.ValidateJWT(signed); err == nil {
+		t.Fatalf("expected error for HS256 token with an EdDSA kid, got nil")
+	}
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "b-ed")
+	writeRSAKey(t, dir, "a-rsa", 2048)
+	keys, err := LoadKeySet(dir, "b-ed")
+	if err != nil {
+		t.Fatalf("LoadKeySet returned error: %v", err)
+	}
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %+v", set.Keys)
+	}
+	rsaKey, edKey := set.Keys[0], set.Keys[1]
+	if rsaKey.KeyID != "a-rsa" || rsaKey.KeyType != "RSA" || rsaKey.Algorithm != "RS256" || rsaKey.E != "AQAB" || rsaKey.N == "" {
+		t.Fatalf("unexpected RSA JWK: %+v", rsaKey)
+	}
+	if edKey.KeyID != "b-ed" || edKey.KeyType != "OKP" || edKey.Curve != "Ed25519" || edKey.Algorithm != "EdDSA" || len(edKey.X) != 43 {
+		t.Fatalf("unexpected Ed25519 JWK: %+v", edKey)
+	}
+
+	if got := NewHMACKeySet("secret").JWKS(); len(got.Keys) != 0 {
+		t.Fatalf("HMAC secrets must not be published, got %+v", got.Keys)
+	}
+}
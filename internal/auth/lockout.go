@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// LockoutPolicy decides how long a login key (an account or a client IP) is
+// locked after a failed attempt. Failures before the LockAfter-th cost
+// nothing; that one locks the key for BaseDelay, and each further failure
+// doubles the lock up to MaxDelay. Failures older than Window are
+// forgotten.
+type LockoutPolicy struct {
+	LockAfter int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+}
+
+// AccountLockout applies to the email a login tried, whether or not it
+// belongs to a user, so locking does not reveal which accounts exist.
+var AccountLockout = LockoutPolicy{
+	LockAfter: 5,
+	BaseDelay: time.Minute,
+	MaxDelay:  time.Hour,
+	Window:    24 * time.Hour,
+}
+
+// IPLockout is looser than AccountLockout because many users can share an
+// address.
+var IPLockout = LockoutPolicy{
+	LockAfter: 20,
+	BaseDelay: time.Minute,
+	MaxDelay:  time.Hour,
+	Window:    24 * time.Hour,
+}
+
+// Delay returns how long to lock a key after its failures-th consecutive
+// failure, or 0 if it is not locked yet.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures < p.LockAfter {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.LockAfter; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := HashPassword(MakeRefreshToken())
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// CheckDummyPassword does the same work as CheckPasswordHash against a hash
+// that nothing matches. Logins for unknown emails call it so they take as
+// long as a wrong password for a real account.
+func CheckDummyPassword(password string) {
+	CheckPasswordHash(password, dummyPasswordHash())
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicy_Delay(t *testing.T) {
+	p := LockoutPolicy{LockAfter: 3, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{500, 10 * time.Minute},
+	}
+	for _, c := range cases {
+		if got := p.Delay(c.failures); got != c.want {
+			t.Fatalf("Delay(%d) = %v, want %v", c.failures, got, c.want)
+		}
+	}
+}
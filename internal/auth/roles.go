@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Role is a user's role, stored in users.role. It fixes the scopes granted to
+// the user's access tokens.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Scopes name what an access token may do. Routes list the scopes they
+// require in registerHandlerFunctions.
+const (
+	// ScopeChirpsWrite allows creating, editing and deleting one's own chirps,
+	// liking and rechirping.
+	ScopeChirpsWrite = "chirps:write"
+	// ScopeUsersWrite allows changing one's own account, follows and sessions.
+	ScopeUsersWrite = "users:write"
+	// ScopeChirpsModerate allows deleting other users' chirps.
+	ScopeChirpsModerate = "chirps:moderate"
+	// ScopeAdmin allows using the admin API.
+	ScopeAdmin = "admin"
+)
+
+var roleScopes = map[Role][]string{
+	RoleUser:      {ScopeChirpsWrite, ScopeUsersWrite},
+	RoleModerator: {ScopeChirpsWrite, ScopeUsersWrite, ScopeChirpsModerate},
+	RoleAdmin:     {ScopeChirpsWrite, ScopeUsersWrite, ScopeChirpsModerate, ScopeAdmin},
+}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleScopes[role]; !ok {
+		return "", fmt.Errorf("unknown role %q; expected user, moderator or admin", s)
+	}
+	return role, nil
+}
+
+// ScopesForRole returns the scopes granted to role, or none for an unknown
+// role.
+func ScopesForRole(role Role) []string {
+	return slices.Clone(roleScopes[role])
+}
+
+// HasScope reports whether role grants scope.
+func (r Role) HasScope(scope string) bool {
+	return slices.Contains(roleScopes[r], scope)
+}
+
+// Claims are the claims of an access token. Scope is a space-separated list,
+// as in RFC 8693.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role  Role   `json:"role,omitempty"`
+	Scope string `json:"scope,omitempty"`
+}
+
+func (c *Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes(), scope)
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestParseJWT_RoleScopes(t *testing.T) {
+	keys := NewHMACKeySet("super-secret")
+	token, err := keys.MakeJWT(uuid.New(), RoleModerator, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+
+	claims, err := keys.ParseJWT(token)
+	if err != nil {
+		t.Fatalf("ParseJWT returned error: %v", err)
+	}
+	if claims.Role != RoleModerator {
+		t.Fatalf("expected role %q, got %q", RoleModerator, claims.Role)
+	}
+	if !claims.HasScope(ScopeChirpsModerate) || !claims.HasScope(ScopeChirpsWrite) {
+		t.Fatalf("expected moderator scopes, got %q", claims.Scope)
+	}
+	if claims.HasScope(ScopeAdmin) {
+		t.Fatalf("moderator must not have scope %q", ScopeAdmin)
+	}
+}
+
+func TestParseJWT_LegacyTokenIsUser(t *testing.T) {
+	secret := "super-secret"
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		Subject:   uuid.New().String(),
+	})
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("SignedString returned error: %v", err)
+	}
+
+	claims, err := NewHMACKeySet(secret).ParseJWT(signed)
+	if err != nil {
+		t.Fatalf("ParseJWT returned error: %v", err)
+	}
+	if claims.Role != RoleUser || !claims.HasScope(ScopeUsersWrite) || claims.HasScope(ScopeChirpsModerate) {
+		t.Fatalf("expected plain user claims, got %+v", claims)
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, s := range []string{"user", "moderator", "admin"} {
+		if _, err := ParseRole(s); err != nil {
+			t.Fatalf("ParseRole(%q) returned error: %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "Admin", "root"} {
+		if _, err := ParseRole(s); err == nil {
+			t.Fatalf("ParseRole(%q): expected error, got nil", s)
+		}
+	}
+}
+
+func TestRoleHasScope(t *testing.T) {
+	if !RoleAdmin.HasScope(ScopeAdmin) || RoleModerator.HasScope(ScopeAdmin) || Role("root").HasScope(ScopeChirpsWrite) {
+		t.Fatalf("HasScope disagrees with the role's scopes")
+	}
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238, base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		got, err := TOTPCode(rfc6238Secret, time.Unix(c.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode returned error: %v", err)
+		}
+		if got != c.want {
+			t.Fatalf("TOTPCode at %d = %s, want %s", c.unix, got, c.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := NewTOTPSecret()
+	now := time.Now()
+	code, err := TOTPCode(secret, now.Add(-30*time.Second))
+	if err != nil {
+		t.Fatalf("TOTPCode returned error: %v", err)
+	}
+	counter, ok := ValidateTOTP(secret, code, now, 0)
+	if !ok {
+		t.Fatalf("expected the previous period's code to be accepted")
+	}
+	if _, ok := ValidateTOTP(secret, code, now, counter); ok {
+		t.Fatalf("expected a used code to be rejected")
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(2*time.Minute), 0); ok {
+		t.Fatalf("expected a stale code to be rejected")
+	}
+	if _, ok := ValidateTOTP(secret, "12345", now, 0); ok {
+		t.Fatalf("expected a short code to be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Chirpy", "alice@example.com", "ABC")
+	want := "otpauth://totp/Chirpy:alice@example.com?algorithm=SHA1&digits=6&issuer=Chirpy&period=30&secret=ABC"
+	if uri != want {
+		t.Fatalf("TOTPURI = %s, want %s", uri, want)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes := MakeRecoveryCodes()
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("expected 10 codes, got %d", len(codes))
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+		typed := strings.ToUpper(strings.Replace(code, "-", " ", 1))
+		if HashRecoveryCode(typed) != hashes[i] {
+			t.Fatalf("hash of %q does not match its stored hash", typed)
+		}
+	}
+}
@@ -0,0 +1,593 @@
+// Package config loads the server's settings. Each setting has a built-in
+// default that can be overridden, in increasing order of precedence, by a
+// YAML or TOML config file, by the environment (including a .env file in the
+// working directory), and by command-line flags. The result is validated as
+// a whole, so the server refuses to start on a missing database URL or a
+// guessable secret rather than running with it.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/IArtMediums/chirp_project/internal/moderation"
+	"github.com/IArtMediums/chirp_project/internal/ratelimit"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the server's effective configuration. Secrets are redacted when
+// it is printed or logged.
+type Config struct {
+	Port     int
+	FileRoot string
+
+	DBURL             string
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+	// AutoMigrate applies pending migrations at startup.
+	AutoMigrate bool
+
+	Platform        string
+	Secret          string
+	JWTKeysDir      string
+	JWTSigningKeyID string
+	PolkaKey        string
+	AdminKey        string
+
+	ModerationMode      moderation.Mode
+	ModerationWordsFile string
+	MailDir             string
+	MailFrom            string
+
+	LogFormat string
+	LogLevel  string
+
+	// RateLimits and RouteTimeouts override the per-route defaults; routes
+	// not listed keep theirs.
+	RateLimits      map[string]ratelimit.Policy
+	RequestTimeout  time.Duration
+	RouteTimeouts   map[string]time.Duration
+	ShutdownTimeout time.Duration
+
+	// File is the config file the settings were read from, if any.
+	File string
+	// PrintConfig asks for the effective config to be printed instead of
+	// starting the server.
+	PrintConfig bool
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() *Config {
+	return &Config{
+		Port:              8080,
+		FileRoot:          ".",
+		DBMaxOpenConns:    25,
+		DBMaxIdleConns:    10,
+		DBConnMaxLifetime: 30 * time.Minute,
+		DBConnMaxIdleTime: 5 * time.Minute,
+		ModerationMode:    moderation.ModeMask,
+		MailFrom:          "chirpy@localhost",
+		LogFormat:         "json",
+		LogLevel:          "info",
+		RateLimits:        map[string]ratelimit.Policy{},
+		RequestTimeout:    10 * time.Second,
+		RouteTimeouts:     map[string]time.Duration{},
+		ShutdownTimeout:   30 * time.Second,
+	}
+}
+
+// setting ties a field of Config to its environment variable. The same
+// setting is written in lower case in config files, and in lower case with
+// dashes as a flag: DB_URL, db_url and -db-url.
+type setting struct {
+	key    string
+	usage  string
+	secret bool
+	// boolean settings may be given as a bare flag, such as -auto-migrate.
+	boolean bool
+	set     func(c *Config, s string) error
+	get     func(c *Config) string
+}
+
+func (s setting) fileKey() string {
+	return strings.ToLower(s.key)
+}
+
+func (s setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(s.key), "_", "-")
+}
+
+// flagValue holds a setting given on the command line until the other
+// sources have been applied.
+type flagValue struct {
+	value   string
+	set     bool
+	boolean bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *flagValue) Set(s string) error {
+	f.value = s
+	f.set = true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.boolean
+}
+
+func stringSetting(key, usage string, field func(c *Config) *string) setting {
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(c *Config, s string) error {
+			*field(c) = s
+			return nil
+		},
+		get: func(c *Config) string { return *field(c) },
+	}
+}
+
+func secretSetting(key, usage string, field func(c *Config) *string) setting {
+	s := stringSetting(key, usage, field)
+	s.secret = true
+	return s
+}
+
+func intSetting(key, usage string, field func(c *Config) *int) setting {
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(c *Config, s string) error {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("must be an integer")
+			}
+			*field(c) = n
+			return nil
+		},
+		get: func(c *Config) string { return strconv.Itoa(*field(c)) },
+	}
+}
+
+func boolSetting(key, usage string, field func(c *Config) *bool) setting {
+	return setting{
+		key:     key,
+		usage:   usage,
+		boolean: true,
+		set: func(c *Config, s string) error {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("must be true or false")
+			}
+			*field(c) = b
+			return nil
+		},
+		get: func(c *Config) string { return strconv.FormatBool(*field(c)) },
+	}
+}
+
+func durationSetting(key, usage string, field func(c *Config) *time.Duration) setting {
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(c *Config, s string) error {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("must be a duration such as 30s or 5m")
+			}
+			*field(c) = d
+			return nil
+		},
+		get: func(c *Config) string { return field(c).String() },
+	}
+}
+
+// settings lists every setting, in the order they are printed.
+var settings = []setting{
+	intSetting("PORT", "port to listen on", func(c *Config) *int { return &c.Port }),
+	stringSetting("FILE_ROOT", "directory served under /app/", func(c *Config) *string { return &c.FileRoot }),
+
+	{
+		key:   "DB_URL",
+		usage: "PostgreSQL connection URL; its password is redacted when printed",
+		set: func(c *Config, s string) error {
+			c.DBURL = s
+			return nil
+		},
+		get: func(c *Config) string { return redactURL(c.DBURL) },
+	},
+	intSetting("DB_MAX_OPEN_CONNS", "maximum open database connections, 0 for no limit", func(c *Config) *int { return &c.DBMaxOpenConns }),
+	intSetting("DB_MAX_IDLE_CONNS", "maximum idle database connections", func(c *Config) *int { return &c.DBMaxIdleConns }),
+	durationSetting("DB_CONN_MAX_LIFETIME", "how long a database connection may be reused, 0 for forever", func(c *Config) *time.Duration { return &c.DBConnMaxLifetime }),
+	durationSetting("DB_CONN_MAX_IDLE_TIME", "how long a database connection may sit idle, 0 for forever", func(c *Config) *time.Duration { return &c.DBConnMaxIdleTime }),
+	boolSetting("AUTO_MIGRATE", "apply pending database migrations at startup", func(c *Config) *bool { return &c.AutoMigrate }),
+
+	stringSetting("PLATFORM", "set to dev to enable POST /admin/reset", func(c *Config) *string { return &c.Platform }),
+	secretSetting("SECRET", "HS256 secret for access tokens, used when JWT_KEYS_DIR is unset", func(c *Config) *string { return &c.Secret }),
+	stringSetting("JWT_KEYS_DIR", "directory of PEM keys for signing access tokens", func(c *Config) *string { return &c.JWTKeysDir }),
+	stringSetting("JWT_SIGNING_KEY_ID", "kid of the key in JWT_KEYS_DIR that signs new tokens", func(c *Config) *string { return &c.JWTSigningKeyID }),
+	secretSetting("POLKA_KEY", "API key Polka sends with webhooks", func(c *Config) *string { return &c.PolkaKey }),
+	secretSetting("ADMIN_KEY", "API key for the admin API, optional", func(c *Config) *string { return &c.AdminKey }),
+
+	{
+		key:   "MODERATION_MODE",
+		usage: "mask, reject or flag",
+		set: func(c *Config, s string) error {
+			mode, err := moderation.ParseMode(s)
+			if err != nil {
+				return err
+			}
+			c.ModerationMode = mode
+			return nil
+		},
+		get: func(c *Config) string { return string(c.ModerationMode) },
+	},
+	stringSetting("MODERATION_WORDS_FILE", "word list file; when unset the list is kept in the database", func(c *Config) *string { return &c.ModerationWordsFile }),
+	stringSetting("MAIL_DIR", "directory to write outgoing emails to; when unset they are logged", func(c *Config) *string { return &c.MailDir }),
+	stringSetting("MAIL_FROM", "From address of outgoing emails", func(c *Config) *string { return &c.MailFrom }),
+
+	stringSetting("LOG_FORMAT", "json or text", func(c *Config) *string { return &c.LogFormat }),
+	stringSetting("LOG_LEVEL", "debug, info, warn or error", func(c *Config) *string { return &c.LogLevel }),
+
+	{
+		key:   "RATE_LIMITS",
+		usage: "per-route rate limits, e.g. \"POST /api/login=10/1m; *=300/1m\"",
+		set: func(c *Config, s string) error {
+			policies, err := ratelimit.ParsePolicies(s)
+			if err != nil {
+				return err
+			}
+			c.RateLimits = policies
+			return nil
+		},
+		get: func(c *Config) string {
+			entries := make([]string, 0, len(c.RateLimits))
+			for route, p := range c.RateLimits {
+				entries = append(entries, route+"="+p.String())
+			}
+			sort.Strings(entries)
+			return strings.Join(entries, "; ")
+		},
+	},
+	durationSetting("REQUEST_TIMEOUT", "how long a request may take", func(c *Config) *time.Duration { return &c.RequestTimeout }),
+	{
+		key:   "ROUTE_TIMEOUTS",
+		usage: "per-route timeouts, e.g. \"GET /api/chirps/search=2s\"",
+		set: func(c *Config, s string) error {
+			timeouts, err := ParseRouteTimeouts(s)
+			if err != nil {
+				return err
+			}
+			c.RouteTimeouts = timeouts
+			return nil
+		},
+		get: func(c *Config) string {
+			entries := make([]string, 0, len(c.RouteTimeouts))
+			for route, d := range c.RouteTimeouts {
+				entries = append(entries, fmt.Sprintf("%s=%s", route, d))
+			}
+			sort.Strings(entries)
+			return strings.Join(entries, "; ")
+		},
+	},
+	durationSetting("SHUTDOWN_TIMEOUT", "how long to wait for in-flight requests on shutdown", func(c *Config) *time.Duration { return &c.ShutdownTimeout }),
+}
+
+// Load reads the configuration for a server started with args, the
+// command-line arguments without the program name. A .env file in the
+// working directory fills in environment variables that are not already
+// set. It returns flag.ErrHelp if args asked for usage.
+func Load(args []string) (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("config: .env: %w", err)
+	}
+	return loadServer(args, os.Getenv, os.Stderr)
+}
+
+func loadServer(args []string, getenv func(string) string, output io.Writer) (*Config, error) {
+	c, rest, err := load(args, getenv, output)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("config: unexpected argument %q", rest[0])
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadCommand is Load for subcommands such as migrate. It returns the
+// arguments that follow the flags, and leaves it to the command to check
+// the settings it uses, since few need a secret or the Polka key.
+func LoadCommand(args []string) (*Config, []string, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("config: .env: %w", err)
+	}
+	return load(args, os.Getenv, os.Stderr)
+}
+
+// load reads the settings without validating them, and returns the
+// arguments that follow the flags.
+func load(args []string, getenv func(string) string, output io.Writer) (*Config, []string, error) {
+	c := Default()
+
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	fs.SetOutput(output)
+	flagValues := map[string]*flagValue{}
+	for _, s := range settings {
+		flagValues[s.key] = &flagValue{boolean: s.boolean}
+		fs.Var(flagValues[s.key], s.flagName(), s.usage+" ("+s.key+")")
+	}
+	file := fs.String("config", getenv("CONFIG_FILE"), "YAML or TOML config file (CONFIG_FILE)")
+	fs.BoolVar(&c.PrintConfig, "print-config", false, "print the effective config, with secrets redacted, and exit")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *file != "" {
+		values, err := readFile(*file)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, s := range settings {
+			if v, ok := values[s.fileKey()]; ok {
+				if err := s.set(c, v); err != nil {
+					return nil, nil, fmt.Errorf("config: %s: %s: %w", *file, s.fileKey(), err)
+				}
+			}
+		}
+		c.File = *file
+	}
+	for _, s := range settings {
+		if v := getenv(s.key); v != "" {
+			if err := s.set(c, v); err != nil {
+				return nil, nil, fmt.Errorf("config: %s: %w", s.key, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if v := flagValues[s.key]; v.set {
+			if err := s.set(c, v.value); err != nil {
+				return nil, nil, fmt.Errorf("config: -%s: %w", s.flagName(), err)
+			}
+		}
+	}
+	return c, fs.Args(), nil
+}
+
+// readFile reads a flat YAML or TOML file of settings, chosen by extension,
+// and returns each value as it would be written in the environment.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	raw := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config: %s: unknown format %q, expected .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %w", path, err)
+	}
+	known := map[string]bool{}
+	for _, s := range settings {
+		known[s.fileKey()] = true
+	}
+	values := map[string]string{}
+	for key, v := range raw {
+		key = strings.ToLower(key)
+		if !known[key] {
+			return nil, fmt.Errorf("config: %s: unknown setting %q", path, key)
+		}
+		switch v.(type) {
+		case map[string]any, []any:
+			return nil, fmt.Errorf("config: %s: %s must be a single value", path, key)
+		}
+		values[key] = fmt.Sprint(v)
+	}
+	return values, nil
+}
+
+// ParseRouteTimeouts reads route timeouts written as "<route>=<duration>"
+// and separated by semicolons, for example
+// "GET /api/chirps/search=2s; POST /api/login=5s".
+func ParseRouteTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, spec, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: expected <route>=<duration>", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(spec))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%q: timeout must be a positive duration such as 5s", entry)
+		}
+		timeouts[strings.Join(strings.Fields(route), " ")] = d
+	}
+	return timeouts, nil
+}
+
+// Minimum lengths for secrets. The HS256 secret and the admin key are ours
+// to generate, so they must carry 256 bits; the Polka key is issued by Polka.
+const (
+	minSecretLength        = 32
+	minPolkaKeyLength      = 16
+	minDistinctSecretChars = 8
+)
+
+// placeholders are example values from the README and the like, which must
+// never make it into a running server.
+var placeholders = []string{"replace-with", "changeme", "change-me", "example"}
+
+// checkSecret rejects secrets that are short, repetitive or copied from an
+// example.
+func checkSecret(name, value string, minLength int) error {
+	if len(value) < minLength {
+		return fmt.Errorf("%s must be at least %d characters", name, minLength)
+	}
+	distinct := map[rune]bool{}
+	for _, c := range value {
+		distinct[c] = true
+	}
+	if len(distinct) < minDistinctSecretChars {
+		return fmt.Errorf("%s is too repetitive to be a secret", name)
+	}
+	lower := strings.ToLower(value)
+	for _, p := range placeholders {
+		if strings.Contains(lower, p) {
+			return fmt.Errorf("%s looks like a placeholder (contains %q)", name, p)
+		}
+	}
+	return nil
+}
+
+// Validate checks that every required setting is present and that every
+// setting makes sense, reporting all problems at once.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be between 1 and 65535"))
+	}
+	if c.FileRoot == "" {
+		errs = append(errs, fmt.Errorf("FILE_ROOT is required"))
+	}
+	if c.DBURL == "" {
+		errs = append(errs, fmt.Errorf("DB_URL is required"))
+	}
+	if c.DBMaxOpenConns < 0 || c.DBMaxIdleConns < 0 {
+		errs = append(errs, fmt.Errorf("DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must not be negative"))
+	} else if c.DBMaxOpenConns > 0 && c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errs = append(errs, fmt.Errorf("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", c.DBMaxIdleConns, c.DBMaxOpenConns))
+	}
+	if c.DBConnMaxLifetime < 0 || c.DBConnMaxIdleTime < 0 {
+		errs = append(errs, fmt.Errorf("DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME must not be negative"))
+	}
+	switch {
+	case c.JWTKeysDir != "":
+		if c.Secret != "" {
+			errs = append(errs, fmt.Errorf("set only one of JWT_KEYS_DIR and SECRET"))
+		}
+	case c.Secret == "":
+		errs = append(errs, fmt.Errorf("JWT_KEYS_DIR or SECRET is required to sign access tokens"))
+	default:
+		if err := checkSecret("SECRET", c.Secret, minSecretLength); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.JWTSigningKeyID != "" && c.JWTKeysDir == "" {
+		errs = append(errs, fmt.Errorf("JWT_SIGNING_KEY_ID needs JWT_KEYS_DIR"))
+	}
+	if c.PolkaKey == "" {
+		errs = append(errs, fmt.Errorf("POLKA_KEY is required"))
+	} else if err := checkSecret("POLKA_KEY", c.PolkaKey, minPolkaKeyLength); err != nil {
+		errs = append(errs, err)
+	}
+	if c.AdminKey != "" {
+		if err := checkSecret("ADMIN_KEY", c.AdminKey, minSecretLength); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if !strings.Contains(c.MailFrom, "@") {
+		errs = append(errs, fmt.Errorf("MAIL_FROM must be an email address"))
+	}
+	switch c.LogFormat {
+	case "json", "text":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be json or text"))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error"))
+	}
+	if c.RequestTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("REQUEST_TIMEOUT must be positive"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("SHUTDOWN_TIMEOUT must be positive"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+const redacted = "[REDACTED]"
+
+// redactURL hides the password in a connection URL but keeps the rest, which
+// is what one needs to check which database the server talks to.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		if s == "" {
+			return ""
+		}
+		return redacted
+	}
+	return u.Redacted()
+}
+
+// value is how s is shown: secrets are redacted unless unset, so that a
+// missing secret still shows up as missing.
+func (c *Config) value(s setting) string {
+	v := s.get(c)
+	if s.secret && v != "" {
+		return redacted
+	}
+	return v
+}
+
+// Print writes the effective config as KEY=value lines, secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	if c.File != "" {
+		if _, err := fmt.Fprintf(w, "# from %s\n", c.File); err != nil {
+			return err
+		}
+	}
+	for _, s := range settings {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", s.key, c.value(s)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogValue logs the effective config as a group, secrets redacted.
+func (c *Config) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(settings))
+	for _, s := range settings {
+		attrs = append(attrs, slog.String(s.fileKey(), c.value(s)))
+	}
+	return slog.GroupValue(attrs...)
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// A QueryObserver is told about every query run through Instrument: its
+// name, how long it took and the error it returned, if any.
+type QueryObserver func(ctx context.Context, name string, d time.Duration, err error)
+
+// Instrument wraps db so that every query run through it is timed and
+// reported to observers. Queries are named by QueryName. Row-returning
+// queries are timed until the first row is available, not until the rows
+// are read.
+func Instrument(db DBTX, observers ...QueryObserver) DBTX {
+	return &instrumentedDB{db: db, observers: observers}
+}
+
+type instrumentedDB struct {
+	db        DBTX
+	observers []QueryObserver
+}
+
+func (i *instrumentedDB) observe(ctx context.Context, query string, start time.Time, err error) {
+	name, d := QueryName(query), time.Since(start)
+	for _, observe := range i.observers {
+		observe(ctx, name, d, err)
+	}
+}
+
+func (i *instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := i.db.ExecContext(ctx, query, args...)
+	i.observe(ctx, query, start, err)
+	return res, err
+}
+
+func (i *instrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return i.db.PrepareContext(ctx, query)
+}
+
+func (i *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := i.db.QueryContext(ctx, query, args...)
+	i.observe(ctx, query, start, err)
+	return rows, err
+}
+
+func (i *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := i.db.QueryRowContext(ctx, query, args...)
+	var err error
+	if row != nil {
+		err = row.Err()
+	}
+	i.observe(ctx, query, start, err)
+	return row
+}
+
+// QueryName returns the name sqlc gives query in its leading "-- name:"
+// comment, or "other" for queries without one.
+func QueryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "other"
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	if name == "" {
+		return "other"
+	}
+	return name
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeDB answers every call with err and no data.
+type fakeDB struct {
+	err error
+}
+
+func (f fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, f.err
+}
+
+func (f fakeDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestQueryName(t *testing.T) {
+	for query, want := range map[string]string{
+		"-- name: GetChirp :one\nSELECT 1": "GetChirp",
+		"-- name:  :one\nSELECT 1":         "other",
+		"SELECT 1":                         "other",
+	} {
+		if got := QueryName(query); got != want {
+			t.Fatalf("QueryName(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	type call struct {
+		name string
+		err  error
+	}
+	var first, second []call
+	observer := func(calls *[]call) QueryObserver {
+		return func(ctx context.Context, name string, d time.Duration, err error) {
+			*calls = append(*calls, call{name, err})
+		}
+	}
+	boom := errors.New("boom")
+	ctx := context.Background()
+
+	Instrument(fakeDB{}, observer(&first), observer(&second)).QueryRowContext(ctx, "-- name: GetChirp :one\nSELECT 1")
+	Instrument(fakeDB{err: boom}, observer(&first), observer(&second)).ExecContext(ctx, "DELETE FROM chirps")
+	Instrument(fakeDB{}, observer(&first), observer(&second)).PrepareContext(ctx, "SELECT 1")
+
+	want := []call{{"GetChirp", nil}, {"other", boom}}
+	for _, calls := range [][]call{first, second} {
+		if len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] {
+			t.Fatalf("expected %v, got %v", want, calls)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Package logging builds the server's structured logger and carries a
+// request-scoped logger, tagged with the request's ID, through contexts so
+// that everything logged while serving a request can be tied back to it.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// New returns a logger writing to w. format is "json" (the default) or
+// "text"; level is "debug", "info" (the default), "warn" or "error".
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("logging: unknown level %q", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("logging: unknown format %q, expected json or text", format)
+	}
+}
+
+type loggerKey struct{}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger stored by WithLogger, or the default logger
+// for contexts that do not belong to a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// maxRequestIDLength bounds request IDs taken from clients, which end up in
+// every log line of their request.
+const maxRequestIDLength = 128
+
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID reports whether a request ID sent by a client or proxy can
+// be kept: it must be short and made only of letters, digits, '-', '_', '.'
+// and ':', so it cannot forge log lines or smuggle markup into them.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// LogQuery logs a query at debug level with the logger from its context. It
+// is a database.QueryObserver, for use with database.Instrument.
+func LogQuery(ctx context.Context, name string, d time.Duration, err error) {
+	logger := FromContext(ctx)
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []any{"query", name, "duration_ms", DurationMillis(d)}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		attrs = append(attrs, "error", err)
+	}
+	logger.DebugContext(ctx, "db query", attrs...)
+}
+
+// DurationMillis is how durations are logged: a plain number of
+// milliseconds reads the same in text and JSON output, unlike slog's default
+// for time.Duration.
+func DurationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", "warn")
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown", "n", 1)
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected a single JSON line, got %q: %v", buf.String(), err)
+	}
+	if line["msg"] != "shown" || line["n"] != float64(1) {
+		t.Fatalf("unexpected log line %v", line)
+	}
+
+	buf.Reset()
+	logger, err = New(&buf, "text", "")
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	logger.Info("hello")
+	if !strings.Contains(buf.String(), "level=INFO msg=hello") {
+		t.Fatalf("unexpected text output %q", buf.String())
+	}
+
+	for _, bad := range [][2]string{{"xml", ""}, {"json", "loud"}} {
+		if _, err := New(&buf, bad[0], bad[1]); err == nil {
+			t.Fatalf("expected error for format %q level %q", bad[0], bad[1])
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) == nil {
+		t.Fatalf("expected the default logger outside a request")
+	}
+	var buf bytes.Buffer
+	logger, _ := New(&buf, "text", "info")
+	ctx := WithLogger(context.Background(), logger.With("request_id", "abc"))
+	FromContext(ctx).Info("inside")
+	if !strings.Contains(buf.String(), "request_id=abc") {
+		t.Fatalf("expected the request logger, got %q", buf.String())
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	for _, id := range []string{"abc", "0f3c-11:22.x_y", NewRequestID(), strings.Repeat("a", maxRequestIDLength)} {
+		if !ValidRequestID(id) {
+			t.Fatalf("expected %q to be valid", id)
+		}
+	}
+	for _, id := range []string{"", "a b", "a\nb", "<script>", strings.Repeat("a", maxRequestIDLength+1)} {
+		if ValidRequestID(id) {
+			t.Fatalf("expected %q to be rejected", id)
+		}
+	}
+	if NewRequestID() == NewRequestID() {
+		t.Fatalf("expected request IDs to differ")
+	}
+}
+
+func TestLogQuery(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := New(&buf, "text", "debug")
+	ctx := WithLogger(context.Background(), logger.With("request_id", "abc"))
+
+	LogQuery(ctx, "GetChirp", time.Millisecond, nil)
+	LogQuery(ctx, "other", time.Millisecond, errors.New("boom"))
+	LogQuery(ctx, "GetUserByEmail", time.Millisecond, sql.ErrNoRows)
+	out := buf.String()
+	for _, want := range []string{
+		"msg=\"db query\" request_id=abc query=GetChirp duration_ms=",
+		"query=other duration_ms=",
+		"error=boom",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in %q", want, out)
+		}
+	}
+	if strings.Count(out, "error=") != 1 {
+		t.Fatalf("expected sql.ErrNoRows not to be logged as an error, got %q", out)
+	}
+
+	buf.Reset()
+	quiet, _ := New(&buf, "text", "info")
+	LogQuery(WithLogger(context.Background(), quiet), "other", time.Millisecond, nil)
+	if buf.Len() != 0 {
+		t.Fatalf("expected no query logs above debug level, got %q", buf.String())
+	}
+}
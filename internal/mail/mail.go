@@ -0,0 +1,74 @@
+// Package mail sends the emails the API needs, such as verification and
+// password reset links. Delivery goes through the Mailer interface; the
+// implementations here never touch the network, so they work offline and in
+// tests.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/logging"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers a message. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer writes every message to the logger of ctx.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	logging.FromContext(ctx).InfoContext(ctx, "mail", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// DirMailer writes each message to its own .eml file in Dir. File names sort
+// in the order the messages were sent.
+type DirMailer struct {
+	Dir  string
+	From string
+
+	mu  sync.Mutex
+	seq int
+}
+
+func NewDirMailer(dir, from string) *DirMailer {
+	return &DirMailer{Dir: dir, From: from}
+}
+
+func (m *DirMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	m.seq++
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s-%06d.eml", now.Format("20060102T150405.000000000"), m.seq)
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(m.From))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(b.String()), 0o600)
+}
+
+// headerValue strips line breaks so a value cannot add headers of its own.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,38 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirMailerWritesMessagesInOrder(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	m := NewDirMailer(dir, "chirpy@localhost")
+	ctx := context.Background()
+	for _, to := range []string{"alice@example.com", "bob@example.com"} {
+		if err := m.Send(ctx, Message{To: to, Subject: "Hello", Body: "line one\nline two"}); err != nil {
+			t.Fatalf("Send returned error: %v", err)
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatalf("Glob returned error: %v", err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("expected 2 messages, got %v", paths)
+	}
+	data, err := os.ReadFile(paths[1])
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	msg := string(data)
+	for _, want := range []string{"From: chirpy@localhost\r\n", "To: bob@example.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline one\r\nline two"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("expected message to contain %q, got:\n%s", want, msg)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Package metrics collects the server's Prometheus metrics: HTTP traffic per
+// route and status, database query timings, and a few application counters.
+// Each Metrics has its own registry, so several servers can run in one
+// process without sharing counts.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "chirpy"
+
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	queries  *prometheus.HistogramVec
+
+	sessionsMu        sync.Mutex
+	sessionsCountedAt time.Time
+
+	// ActiveSessions is the number of sessions with a live refresh token.
+	// It is set by RefreshActiveSessions.
+	ActiveSessions prometheus.Gauge
+	ChirpsCreated  prometheus.Counter
+	// LoginFailures counts wrong passwords and wrong second factors alike.
+	LoginFailures prometheus.Counter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by route and status code.",
+		}, []string{"route", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests, by route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "code"}),
+		queries: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Time taken to run database queries, by query name.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"query"}),
+		ActiveSessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_sessions",
+			Help:      "Sessions with an unexpired, unrevoked refresh token.",
+		}),
+		ChirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chirps_created_total",
+			Help:      "Chirps created, including replies.",
+		}),
+		LoginFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_failures_total",
+			Help:      "Failed login attempts, at either the password or the two-factor step.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.latency,
+		m.queries,
+		m.ActiveSessions,
+		m.ChirpsCreated,
+		m.LoginFailures,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RefreshActiveSessions sets ActiveSessions from count, unless it was set
+// less than ttl ago, so that frequent scrapes do not each cost a query.
+// Concurrent callers wait for one count rather than running their own.
+func (m *Metrics) RefreshActiveSessions(ctx context.Context, ttl time.Duration, count func(context.Context) (int64, error)) error {
+	m.sessionsMu.Lock()
+	defer m.sessionsMu.Unlock()
+	if !m.sessionsCountedAt.IsZero() && time.Since(m.sessionsCountedAt) < ttl {
+		return nil
+	}
+	sessions, err := count(ctx)
+	if err != nil {
+		return err
+	}
+	m.ActiveSessions.Set(float64(sessions))
+	m.sessionsCountedAt = time.Now()
+	return nil
+}
+
+// ObserveRequest records a served request. route should be the ServeMux
+// pattern rather than the path, so that IDs in paths do not create a series
+// each.
+func (m *Metrics) ObserveRequest(route string, status int, d time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, code).Inc()
+	m.latency.WithLabelValues(route, code).Observe(d.Seconds())
+}
+
+// ObserveQuery records a query's duration by name. It is a
+// database.QueryObserver, for use with database.Instrument.
+func (m *Metrics) ObserveQuery(ctx context.Context, name string, d time.Duration, err error) {
+	m.queries.WithLabelValues(name).Observe(d.Seconds())
+}
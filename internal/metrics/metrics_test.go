@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("read metrics: %v", err)
+	}
+	return string(body)
+}
+
+func TestMetricsExposition(t *testing.T) {
+	m := New()
+	m.ObserveRequest("GET /api/chirps/{chirpID}", 200, 30*time.Millisecond)
+	m.ObserveRequest("GET /api/chirps/{chirpID}", 404, time.Millisecond)
+	m.ChirpsCreated.Inc()
+	m.ActiveSessions.Set(3)
+
+	m.ObserveQuery(context.Background(), "GetChirp", time.Millisecond, nil)
+	m.ObserveQuery(context.Background(), "other", time.Millisecond, errors.New("boom"))
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`chirpy_http_requests_total{code="200",route="GET /api/chirps/{chirpID}"} 1`,
+		`chirpy_http_requests_total{code="404",route="GET /api/chirps/{chirpID}"} 1`,
+		`chirpy_http_request_duration_seconds_bucket{code="200",route="GET /api/chirps/{chirpID}",le="0.05"} 1`,
+		`chirpy_db_query_duration_seconds_count{query="GetChirp"} 1`,
+		`chirpy_db_query_duration_seconds_count{query="other"} 1`,
+		`chirpy_chirps_created_total 1`,
+		`chirpy_active_sessions 3`,
+		`chirpy_login_failures_total 0`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("metrics output missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsAreIndependent(t *testing.T) {
+	a, b := New(), New()
+	a.LoginFailures.Inc()
+	if body := scrape(t, b); !strings.Contains(body, "chirpy_login_failures_total 0") {
+		t.Fatalf("expected a fresh registry, got:\n%s", body)
+	}
+}
+
+func TestRefreshActiveSessions(t *testing.T) {
+	m := New()
+	calls := 0
+	count := func(ctx context.Context) (int64, error) {
+		calls++
+		return int64(calls), nil
+	}
+	for range 3 {
+		if err := m.RefreshActiveSessions(context.Background(), time.Minute, count); err != nil {
+			t.Fatalf("RefreshActiveSessions returned error: %v", err)
+		}
+	}
+	if calls != 1 || !strings.Contains(scrape(t, m), "chirpy_active_sessions 1") {
+		t.Fatalf("expected one count within the ttl, got %d", calls)
+	}
+	if err := m.RefreshActiveSessions(context.Background(), 0, count); err != nil || calls != 2 {
+		t.Fatalf("expected a fresh count once the ttl passed, got %d calls, %v", calls, err)
+	}
+
+	failing := New()
+	boom := errors.New("boom")
+	if err := failing.RefreshActiveSessions(context.Background(), time.Minute, func(context.Context) (int64, error) { return 0, boom }); err != boom {
+		t.Fatalf("expected the count error, got %v", err)
+	}
+	if err := failing.RefreshActiveSessions(context.Background(), time.Minute, count); err != nil || calls != 3 {
+		t.Fatalf("expected a failed count not to be cached, got %d calls, %v", calls, err)
+	}
+}
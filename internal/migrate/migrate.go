@@ -0,0 +1,162 @@
+// Package migrate applies the goose migrations embedded from sql/schema. It
+// keeps goose's bookkeeping table, goose_db_version, so databases migrated
+// with the goose command line carry on where they left off.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/IArtMediums/chirp_project/sql/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// Dir is where Create writes new migrations, relative to the repository
+// root. They are embedded the next time the server is built.
+const Dir = "sql/schema"
+
+// ErrBehind means the database is missing migrations the server needs.
+var ErrBehind = errors.New("database schema is behind")
+
+// ErrNothingToRollBack is returned by Down on a database without migrations.
+var ErrNothingToRollBack = errors.New("no migrations to roll back")
+
+// Migrator applies the embedded migrations to one database. Each run holds
+// a Postgres advisory lock, so instances that start together with
+// AUTO_MIGRATE take turns rather than racing.
+type Migrator struct {
+	provider *goose.Provider
+}
+
+// New returns a Migrator for db. It does not touch the database.
+func New(db *sql.DB) (*Migrator, error) {
+	return newMigrator(db, schema.Migrations)
+}
+
+func newMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, fsys, goose.WithSessionLocker(locker))
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return &Migrator{provider: provider}, nil
+}
+
+// Latest is the version of the newest migration, the one the server
+// expects the database to be at.
+func (m *Migrator) Latest() int64 {
+	sources := m.provider.ListSources()
+	if len(sources) == 0 {
+		return 0
+	}
+	return sources[len(sources)-1].Version
+}
+
+// Up applies every pending migration, oldest first, and returns what it
+// applied. On failure the results include the migration that failed.
+func (m *Migrator) Up(ctx context.Context) ([]*goose.MigrationResult, error) {
+	results, err := m.provider.Up(ctx)
+	if err != nil {
+		var partial *goose.PartialError
+		if errors.As(err, &partial) {
+			results = append(partial.Applied, partial.Failed)
+		}
+		return results, fmt.Errorf("migrate up: %w", err)
+	}
+	return results, nil
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) (*goose.MigrationResult, error) {
+	result, err := m.provider.Down(ctx)
+	if errors.Is(err, goose.ErrNoNextVersion) {
+		return nil, ErrNothingToRollBack
+	}
+	if err != nil {
+		return result, fmt.Errorf("migrate down: %w", err)
+	}
+	return result, nil
+}
+
+// Status lists every migration, applied or pending, oldest first.
+func (m *Migrator) Status(ctx context.Context) ([]*goose.MigrationStatus, error) {
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate status: %w", err)
+	}
+	return statuses, nil
+}
+
+// Check reports the database's schema version and the latest one, and
+// returns an error wrapping ErrBehind if any migration is pending. A
+// database ahead of the server, as during a rolling deploy, passes.
+func (m *Migrator) Check(ctx context.Context) (current, latest int64, err error) {
+	current, latest, err = m.provider.GetVersions(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("migrate: %w", err)
+	}
+	pending, err := m.provider.HasPending(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("migrate: %w", err)
+	}
+	if pending {
+		return current, latest, fmt.Errorf("%w: it is at version %d, the server needs %d; run `chirpy migrate up` or set AUTO_MIGRATE=true", ErrBehind, current, latest)
+	}
+	return current, latest, nil
+}
+
+var (
+	migrationFile = regexp.MustCompile(`^(\d+)_.+\.sql$`)
+	migrationName = regexp.MustCompile(`^[a-z0-9]+(_[a-z0-9]+)*$`)
+)
+
+const migrationTemplate = `-- +goose Up
+
+-- +goose Down
+`
+
+// Create writes an empty migration to dir, numbered after the newest one
+// there, and returns its path. name is lower case words joined by
+// underscores, such as add_user_bios.
+func Create(dir, name string) (string, error) {
+	if !migrationName.MatchString(name) {
+		return "", fmt.Errorf("migration name %q must be lower case words joined by underscores, such as add_user_bios", name)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var latest int64
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		latest = max(latest, version)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%03d_%s.sql", latest+1, name))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(migrationTemplate); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
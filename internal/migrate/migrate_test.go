@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	// sql.Open does not connect, and neither does New.
+	db, err := sql.Open("postgres", "postgres://localhost/chirpy")
+	if err != nil {
+		t.Fatalf("sql.Open returned error: %v", err)
+	}
+	defer db.Close()
+	m, err := New(db)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join("..", "..", Dir, "*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("expected migrations in %s, got %v %v", Dir, files, err)
+	}
+	sources := m.provider.ListSources()
+	if len(sources) != len(files) {
+		t.Fatalf("expected %d embedded migrations, got %d", len(files), len(sources))
+	}
+	for i, source := range sources {
+		if source.Path != filepath.Base(files[i]) || source.Version != int64(i+1) {
+			t.Fatalf("migration %d: expected %s, got %s version %d", i+1, filepath.Base(files[i]), source.Path, source.Version)
+		}
+	}
+	if m.Latest() != int64(len(files)) {
+		t.Fatalf("expected latest version %d, got %d", len(files), m.Latest())
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"001_users.sql", "009_sessions.sql", "README.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	path, err := Create(dir, "add_user_bios")
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if filepath.Base(path) != "010_add_user_bios.sql" {
+		t.Fatalf("expected the next number, got %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "-- +goose Up") || !strings.Contains(string(data), "-- +goose Down") {
+		t.Fatalf("expected a goose template, got %q %v", data, err)
+	}
+
+	for _, bad := range []string{"", "Add Bios", "add-bios", "../escape", "bios_"} {
+		if _, err := Create(dir, bad); err == nil {
+			t.Fatalf("expected error for name %q", bad)
+		}
+	}
+	if _, err := Create(filepath.Join(dir, "missing"), "add_user_bios"); err == nil {
+		t.Fatalf("expected error for a missing directory")
+	}
+}
@@ -0,0 +1,97 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileSource keeps the word list in a text file with one word per line.
+// Blank lines and lines starting with # are ignored. Edits rewrite the whole
+// file, so comments are not preserved.
+type FileSource struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{Path: path}
+}
+
+func (s *FileSource) LoadWords(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
+
+func (s *FileSource) AddWord(ctx context.Context, word string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	words, err := s.read()
+	if err != nil {
+		return err
+	}
+	for _, w := range words {
+		if w == word {
+			return nil
+		}
+	}
+	return s.write(append(words, word))
+}
+
+func (s *FileSource) RemoveWord(ctx context.Context, word string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	words, err := s.read()
+	if err != nil {
+		return err
+	}
+	kept := []string{}
+	for _, w := range words {
+		if w != word {
+			kept = append(kept, w)
+		}
+	}
+	return s.write(kept)
+}
+
+func (s *FileSource) read() ([]string, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	words := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, strings.ToLower(line))
+	}
+	return words, scanner.Err()
+}
+
+// write replaces the file atomically via a temporary file and rename.
+func (s *FileSource) write(words []string) error {
+	sort.Strings(words)
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), ".moderation-words-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(strings.Join(words, "\n") + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
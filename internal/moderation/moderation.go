@@ -0,0 +1,203 @@
+// Package moderation implements the configurable profanity filter applied to
+// chirp bodies.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Mode decides what happens to a chirp that contains a listed word.
+type Mode string
+
+const (
+	// ModeMask replaces every listed word with "****".
+	ModeMask Mode = "mask"
+	// ModeReject refuses the chirp.
+	ModeReject Mode = "reject"
+	// ModeFlag keeps the chirp unchanged and records it for review.
+	ModeFlag Mode = "flag"
+)
+
+const mask = "****"
+
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return ModeMask, nil
+	case ModeMask, ModeReject, ModeFlag:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown moderation mode: %q", s)
+	}
+}
+
+// WordSource persists the word list. Filter loads it once at startup and
+// writes through it on every runtime edit.
+type WordSource interface {
+	LoadWords(ctx context.Context) ([]string, error)
+	AddWord(ctx context.Context, word string) error
+	RemoveWord(ctx context.Context, word string) error
+}
+
+// Result describes a checked text. Text is the body to store: masked in
+// ModeMask, unchanged otherwise. Matches lists the distinct normalized words
+// that were found.
+type Result struct {
+	Text    string
+	Matches []string
+}
+
+func (r Result) Matched() bool {
+	return len(r.Matches) > 0
+}
+
+// Filter is safe for concurrent use.
+type Filter struct {
+	mode   Mode
+	source WordSource
+
+	mu    sync.RWMutex
+	words map[string]struct{}
+}
+
+func NewFilter(ctx context.Context, source WordSource, mode Mode) (*Filter, error) {
+	words, err := source.LoadWords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f := &Filter{
+		mode:   mode,
+		source: source,
+		words:  map[string]struct{}{},
+	}
+	for _, word := range words {
+		normalized, err := NormalizeWord(word)
+		if err != nil {
+			return nil, err
+		}
+		f.words[normalized] = struct{}{}
+	}
+	return f, nil
+}
+
+func (f *Filter) Mode() Mode {
+	return f.mode
+}
+
+// Words returns the current list, sorted.
+func (f *Filter) Words() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	words := make([]string, 0, len(f.words))
+	for word := range f.words {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+func (f *Filter) AddWord(ctx context.Context, word string) (string, error) {
+	normalized, err := NormalizeWord(word)
+	if err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.source.AddWord(ctx, normalized); err != nil {
+		return "", err
+	}
+	f.words[normalized] = struct{}{}
+	return normalized, nil
+}
+
+func (f *Filter) RemoveWord(ctx context.Context, word string) error {
+	normalized, err := NormalizeWord(word)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.source.RemoveWord(ctx, normalized); err != nil {
+		return err
+	}
+	delete(f.words, normalized)
+	return nil
+}
+
+// Check scans text word by word. Punctuation and spacing are preserved, so
+// "Kerfuffle!" masks to "****!".
+func (f *Filter) Check(text string) Result {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var b strings.Builder
+	found := map[string]struct{}{}
+	res := Result{}
+	for _, tok := range Tokenize(text) {
+		if !tok.Word {
+			b.WriteString(tok.Text)
+			continue
+		}
+		normalized := strings.ToLower(tok.Text)
+		if _, ok := f.words[normalized]; !ok {
+			b.WriteString(tok.Text)
+			continue
+		}
+		if _, ok := found[normalized]; !ok {
+			found[normalized] = struct{}{}
+			res.Matches = append(res.Matches, normalized)
+		}
+		if f.mode == ModeMask {
+			b.WriteString(mask)
+		} else {
+			b.WriteString(tok.Text)
+		}
+	}
+	res.Text = b.String()
+	return res
+}
+
+// Token is a run of either word characters or everything else.
+type Token struct {
+	Text string
+	Word bool
+}
+
+// Tokenize splits text into alternating word and non-word tokens. Word
+// characters are Unicode letters, marks and digits; concatenating the tokens
+// gives back the original text.
+func Tokenize(text string) []Token {
+	tokens := []Token{}
+	start := 0
+	inWord := false
+	for i, r := range text {
+		w := isWordRune(r)
+		if i > 0 && w != inWord {
+			tokens = append(tokens, Token{Text: text[start:i], Word: inWord})
+			start = i
+		}
+		inWord = w
+	}
+	if start < len(text) {
+		tokens = append(tokens, Token{Text: text[start:], Word: inWord})
+	}
+	return tokens
+}
+
+// NormalizeWord lower-cases word and checks that it is a single token.
+func NormalizeWord(word string) (string, error) {
+	word = strings.TrimSpace(word)
+	tokens := Tokenize(word)
+	if len(tokens) != 1 || !tokens[0].Word {
+		return "", fmt.Errorf("invalid moderation word: %q", word)
+	}
+	return strings.ToLower(word), nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,151 @@
+package moderation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type staticSource struct {
+	words []string
+}
+
+func (s *staticSource) LoadWords(ctx context.Context) ([]string, error) {
+	return s.words, nil
+}
+
+func (s *staticSource) AddWord(ctx context.Context, word string) error {
+	return nil
+}
+
+func (s *staticSource) RemoveWord(ctx context.Context, word string) error {
+	return nil
+}
+
+func newTestFilter(t *testing.T, mode Mode) *Filter {
+	t.Helper()
+	f, err := NewFilter(context.Background(), &staticSource{words: []string{"kerfuffle", "sharbert", "Fornax"}}, mode)
+	if err != nil {
+		t.Fatalf("NewFilter returned error: %v", err)
+	}
+	return f
+}
+
+func TestCheckMask(t *testing.T) {
+	f := newTestFilter(t, ModeMask)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "what a kerfuffle today", want: "what a **** today"},
+		{name: "trailing punctuation", in: "Kerfuffle!", want: "****!"},
+		{name: "comma", in: "kerfuffle, sharbert.", want: "****, ****."},
+		{name: "case insensitive", in: "FORNAX rocks", want: "**** rocks"},
+		{name: "substring untouched", in: "kerfuffles are fine", want: "kerfuffles are fine"},
+		{name: "whitespace preserved", in: "a\tkerfuffle\n b", want: "a\t****\n b"},
+		{name: "quotes", in: `"sharbert"`, want: `"****"`},
+		{name: "clean", in: "hello chirpy", want: "hello chirpy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := f.Check(tt.in)
+			if got.Text != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got.Text)
+			}
+		})
+	}
+}
+
+func TestCheckRejectAndFlagKeepText(t *testing.T) {
+	for _, mode := range []Mode{ModeReject, ModeFlag} {
+		f := newTestFilter(t, mode)
+		got := f.Check("Kerfuffle! kerfuffle and fornax")
+		if got.Text != "Kerfuffle! kerfuffle and fornax" {
+			t.Fatalf("%s: expected text unchanged, got %q", mode, got.Text)
+		}
+		if want := []string{"kerfuffle", "fornax"}; !reflect.DeepEqual(got.Matches, want) {
+			t.Fatalf("%s: expected matches %v, got %v", mode, want, got.Matches)
+		}
+	}
+}
+
+func TestTokenizeUnicode(t *testing.T) {
+	text := "Grüße, naïve café—日本語!"
+	tokens := Tokenize(text)
+	words := []string{}
+	joined := ""
+	for _, tok := range tokens {
+		joined += tok.Text
+		if tok.Word {
+			words = append(words, tok.Text)
+		}
+	}
+	if joined != text {
+		t.Fatalf("tokens do not round-trip: %q", joined)
+	}
+	if want := []string{"Grüße", "naïve", "café", "日本語"}; !reflect.DeepEqual(words, want) {
+		t.Fatalf("expected words %v, got %v", want, words)
+	}
+}
+
+func TestNormalizeWord(t *testing.T) {
+	if got, err := NormalizeWord("  Kerfuffle "); err != nil || got != "kerfuffle" {
+		t.Fatalf("expected kerfuffle, got %q (err %v)", got, err)
+	}
+	for _, bad := range []string{"", "two words", "bang!"} {
+		if _, err := NormalizeWord(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if m, err := ParseMode(""); err != nil || m != ModeMask {
+		t.Fatalf("expected default mask, got %q (err %v)", m, err)
+	}
+	if m, err := ParseMode("Reject"); err != nil || m != ModeReject {
+		t.Fatalf("expected reject, got %q (err %v)", m, err)
+	}
+	if _, err := ParseMode("shout"); err == nil {
+		t.Fatalf("expected error for unknown mode")
+	}
+}
+
+func TestFileSourceEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# banned\nkerfuffle\n\nSharbert\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	ctx := context.Background()
+	f, err := NewFilter(ctx, NewFileSource(path), ModeMask)
+	if err != nil {
+		t.Fatalf("NewFilter returned error: %v", err)
+	}
+	if want := []string{"kerfuffle", "sharbert"}; !reflect.DeepEqual(f.Words(), want) {
+		t.Fatalf("expected %v, got %v", want, f.Words())
+	}
+
+	if _, err := f.AddWord(ctx, "Fornax"); err != nil {
+		t.Fatalf("AddWord returned error: %v", err)
+	}
+	if err := f.RemoveWord(ctx, "kerfuffle"); err != nil {
+		t.Fatalf("RemoveWord returned error: %v", err)
+	}
+	if got := f.Check("kerfuffle fornax").Text; got != "kerfuffle ****" {
+		t.Fatalf("expected edits to apply immediately, got %q", got)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "fornax\nsharbert" {
+		t.Fatalf("expected file to be rewritten, got %q", got)
+	}
+}
@@ -0,0 +1,156 @@
+// Package ratelimit implements token-bucket rate limiting. Buckets live in a
+// Store: Memory keeps them in process, which is enough for a single server;
+// several servers behind a load balancer need a shared Store so a client
+// cannot multiply its allowance by spreading requests across them.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy allows Limit requests per Window. The bucket holds Limit tokens, so
+// a client may use its whole allowance in a burst, and refills at an even
+// rate over Window.
+type Policy struct {
+	Limit  int
+	Window time.Duration
+}
+
+func (p Policy) String() string {
+	return fmt.Sprintf("%d/%s", p.Limit, p.Window)
+}
+
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Window.Seconds()
+}
+
+// Result is the outcome of taking a token. Remaining is what is left after
+// this request, RetryAfter how long a denied client must wait for the next
+// token, and Reset how long until the bucket is full again.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// Store takes a token for key from a bucket shaped by p. Implementations
+// must be safe for concurrent use.
+type Store interface {
+	Take(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	window  time.Duration
+}
+
+// sweepInterval is how often Memory drops buckets that have refilled, which
+// behave exactly like missing ones.
+const sweepInterval = time.Minute
+
+// Memory is an in-process Store.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	if p.Limit <= 0 || p.Window <= 0 {
+		return Result{}, fmt.Errorf("ratelimit: invalid policy %v", p)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+	rate := p.rate()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Limit), updated: now}
+		m.buckets[key] = b
+	}
+	b.window = p.Window
+	b.tokens = math.Min(float64(p.Limit), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	res := Result{Limit: p.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(p.Limit) - b.tokens) / rate)
+	return res, nil
+}
+
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) >= b.window {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// ParsePolicies reads per-route policies written as
+// "<route>=<limit>/<window>" and separated by semicolons, for example
+// "POST /api/login=10/1m; POST /api/chirps=30/1m". Routes are ServeMux
+// patterns; "*" sets the default for routes without their own policy.
+func ParsePolicies(s string) (map[string]Policy, error) {
+	policies := map[string]Policy{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, spec, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("ratelimit: %q: expected <route>=<limit>/<window>", entry)
+		}
+		p, err := parsePolicy(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, fmt.Errorf("ratelimit: %q: %w", entry, err)
+		}
+		policies[strings.Join(strings.Fields(route), " ")] = p
+	}
+	return policies, nil
+}
+
+func parsePolicy(s string) (Policy, error) {
+	limit, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("expected <limit>/<window>")
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return Policy{}, fmt.Errorf("limit must be a positive integer")
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Policy{}, fmt.Errorf("window must be a positive duration such as 1m")
+	}
+	return Policy{Limit: n, Window: d}, nil
+}
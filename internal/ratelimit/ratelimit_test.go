@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestMemory(start time.Time) (*Memory, *time.Time) {
+	m := NewMemory()
+	now := start
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestMemory_TakeAndRefill(t *testing.T) {
+	m, now := newTestMemory(time.Unix(1_000_000, 0))
+	ctx := context.Background()
+	p := Policy{Limit: 3, Window: 3 * time.Second}
+
+	for i := 2; i >= 0; i-- {
+		res, err := m.Take(ctx, "k", p)
+		if err != nil {
+			t.Fatalf("Take returned error: %v", err)
+		}
+		if !res.Allowed || res.Remaining != i || res.Limit != 3 {
+			t.Fatalf("expected allowed with %d remaining, got %+v", i, res)
+		}
+	}
+	res, _ := m.Take(ctx, "k", p)
+	if res.Allowed || res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Fatalf("expected denied for 1s, got %+v", res)
+	}
+	if other, _ := m.Take(ctx, "other", p); !other.Allowed {
+		t.Fatalf("buckets must be independent per key")
+	}
+
+	*now = now.Add(time.Second)
+	if res, _ := m.Take(ctx, "k", p); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("expected one token after 1s, got %+v", res)
+	}
+	*now = now.Add(time.Hour)
+	if res, _ := m.Take(ctx, "k", p); !res.Allowed || res.Remaining != 2 {
+		t.Fatalf("expected a full bucket after an hour, got %+v", res)
+	}
+}
+
+func TestMemory_SweepsFullBuckets(t *testing.T) {
+	m, now := newTestMemory(time.Unix(1_000_000, 0))
+	ctx := context.Background()
+	m.Take(ctx, "old", Policy{Limit: 1, Window: time.Second})
+	*now = now.Add(2 * sweepInterval)
+	m.Take(ctx, "new", Policy{Limit: 1, Window: time.Second})
+	if _, ok := m.buckets["old"]; ok || len(m.buckets) != 1 {
+		t.Fatalf("expected only the new bucket to remain, got %v", m.buckets)
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	got, err := ParsePolicies(" POST  /api/login=10/1m; *=300/1m;")
+	if err != nil {
+		t.Fatalf("ParsePolicies returned error: %v", err)
+	}
+	if len(got) != 2 || got["POST /api/login"] != (Policy{10, time.Minute}) || got["*"] != (Policy{300, time.Minute}) {
+		t.Fatalf("unexpected policies %v", got)
+	}
+	for _, bad := range []string{"POST /api/login", "x=0/1m", "x=10", "x=10/soon", "x=10/-1s"} {
+		if _, err := ParsePolicies(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
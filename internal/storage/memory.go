@@ -0,0 +1,576 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+// ErrUniqueViolation is returned by Memory where Postgres would raise a
+// unique constraint violation.
+var ErrUniqueViolation = errors.New("storage: unique constraint violation")
+
+// ErrForeignKeyViolation is returned by Memory where Postgres would raise a
+// foreign key constraint violation.
+var ErrForeignKeyViolation = errors.New("storage: foreign key constraint violation")
+
+const refreshTokenLifetime = 60 * 24 * time.Hour
+
+// Memory is a thread-safe, in-process Store. It follows the semantics of the
+// SQL queries closely enough for handler tests: lookups that miss return
+// sql.ErrNoRows, ResetUsers cascades to chirps and tokens, and timestamps are
+// truncated to Postgres' microsecond precision.
+type Memory struct {
+	mu       sync.RWMutex
+	users    map[uuid.UUID]database.User
+	chirps   map[uuid.UUID]database.Chirp
+	tokens   map[string]database.RefreshToken
+	follows  map[followKey]database.Follow
+	likes    map[engagementKey]database.ChirpLike
+	rechirps map[engagementKey]database.Rechirp
+	words    map[string]database.ProfaneWord
+	flags    map[uuid.UUID]database.ModerationFlag
+	// revisions holds each chirp's prior bodies, oldest first.
+	revisions map[uuid.UUID][]database.ChirpRevision
+	audit     map[uuid.UUID]database.AdminAuditLog
+	// emailTokens is keyed by token hash.
+	emailTokens map[string]database.EmailToken
+	throttles   map[throttleKey]database.LoginThrottle
+	totp        map[uuid.UUID]database.UserTotp
+	// recoveryCodes is keyed by user, then code hash.
+	recoveryCodes map[uuid.UUID]map[string]database.RecoveryCode
+	// challenges is keyed by token hash.
+	challenges map[string]database.LoginChallenge
+}
+
+// NewMemory returns an empty store seeded with the same profane words as the
+// moderation migration.
+func NewMemory() *Memory {
+	m := &Memory{
+		users:     map[uuid.UUID]database.User{},
+		chirps:    map[uuid.UUID]database.Chirp{},
+		tokens:    map[string]database.RefreshToken{},
+		follows:   map[followKey]database.Follow{},
+		likes:     map[engagementKey]database.ChirpLike{},
+		rechirps:  map[engagementKey]database.Rechirp{},
+		words:     map[string]database.ProfaneWord{},
+		flags:     map[uuid.UUID]database.ModerationFlag{},
+		revisions: map[uuid.UUID][]database.ChirpRevision{},
+		audit:     map[uuid.UUID]database.AdminAuditLog{},
+
+		emailTokens: map[string]database.EmailToken{},
+		throttles:   map[throttleKey]database.LoginThrottle{},
+		totp:        map[uuid.UUID]database.UserTotp{},
+
+		recoveryCodes: map[uuid.UUID]map[string]database.RecoveryCode{},
+		challenges:    map[string]database.LoginChallenge{},
+	}
+	t := now()
+	for _, word := range []string{"kerfuffle", "sharbert", "fornax"} {
+		m.words[word] = database.ProfaneWord{Word: word, CreatedAt: t}
+	}
+	return m
+}
+
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.emailTaken(arg.Email, uuid.Nil) {
+		return database.CreateUserRow{}, ErrUniqueViolation
+	}
+	t := now()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      t,
+		UpdatedAt:      t,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Role:           "user",
+	}
+	m.users[user.ID] = user
+	return database.CreateUserRow{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+	}, nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *Memory) UpdateUserLogin(ctx context.Context, arg database.UpdateUserLoginParams) (database.UpdateUserLoginRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[arg.ID]
+	if !ok {
+		return database.UpdateUserLoginRow{}, sql.ErrNoRows
+	}
+	if m.emailTaken(arg.Email, arg.ID) {
+		return database.UpdateUserLoginRow{}, ErrUniqueViolation
+	}
+	if user.Email != arg.Email {
+		user.EmailVerifiedAt = sql.NullTime{}
+	}
+	user.Email = arg.Email
+	user.HashedPassword = arg.HashedPassword
+	user.UpdatedAt = now()
+	m.users[user.ID] = user
+	return database.UpdateUserLoginRow{
+		ID:              user.ID,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+		Email:           user.Email,
+		IsChirpyRed:     user.IsChirpyRed,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+	}, nil
+}
+
+func (m *Memory) UpgradeUser(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil
+	}
+	user.IsChirpyRed = true
+	user.UpdatedAt = now()
+	m.users[id] = user
+	return nil
+}
+
+func (m *Memory) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.SetUserRoleRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[arg.ID]
+	if !ok {
+		return database.SetUserRoleRow{}, sql.ErrNoRows
+	}
+	user.Role = arg.Role
+	user.UpdatedAt = now()
+	m.users[user.ID] = user
+	return database.SetUserRoleRow{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		Role:        user.Role,
+	}, nil
+}
+
+func (m *Memory) ResetUsers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users = map[uuid.UUID]database.User{}
+	m.chirps = map[uuid.UUID]database.Chirp{}
+	m.tokens = map[string]database.RefreshToken{}
+	m.follows = map[followKey]database.Follow{}
+	m.likes = map[engagementKey]database.ChirpLike{}
+	m.rechirps = map[engagementKey]database.Rechirp{}
+	m.flags = map[uuid.UUID]database.ModerationFlag{}
+	m.revisions = map[uuid.UUID][]database.ChirpRevision{}
+	m.emailTokens = map[string]database.EmailToken{}
+	m.totp = map[uuid.UUID]database.UserTotp{}
+	m.recoveryCodes = map[uuid.UUID]map[string]database.RecoveryCode{}
+	m.challenges = map[string]database.LoginChallenge{}
+	// The audit log outlives the users it mentions, as with ON DELETE SET NULL.
+	for id, entry := range m.audit {
+		entry.ActorUserID = uuid.NullUUID{}
+		m.audit[id] = entry
+	}
+	return nil
+}
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.Chirp{}, ErrForeignKeyViolation
+	}
+	if arg.ReplyTo.Valid {
+		parent, ok := m.chirps[arg.ReplyTo.UUID]
+		if !ok {
+			return database.Chirp{}, ErrForeignKeyViolation
+		}
+		parent.ReplyCount++
+		m.chirps[parent.ID] = parent
+	}
+	t := now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		ReplyTo:   arg.ReplyTo,
+	}
+	m.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	chirp, ok := m.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (m *Memory) ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error) {
+	return m.listChirps(arg, false), nil
+}
+
+func (m *Memory) ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error) {
+	return m.listChirps(database.ListChirpsAscParams(arg), true), nil
+}
+
+func (m *Memory) listChirps(arg database.ListChirpsAscParams, desc bool) []database.Chirp {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []database.Chirp{}
+	for _, chirp := range m.chirps {
+		if chirp.DeletedAt.Valid {
+			continue
+		}
+		if arg.AuthorID.Valid && chirp.UserID != arg.AuthorID.UUID {
+			continue
+		}
+		if arg.CursorCreatedAt.Valid {
+			c := compareKeyset(chirp.CreatedAt, chirp.ID, arg.CursorCreatedAt.Time, arg.CursorID.UUID)
+			if (!desc && c <= 0) || (desc && c >= 0) {
+				continue
+			}
+		}
+		items = append(items, chirp)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		c := compareKeyset(items[i].CreatedAt, items[i].ID, items[j].CreatedAt, items[j].ID)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	if len(items) > int(arg.Limit) {
+		items = items[:arg.Limit]
+	}
+	return items
+}
+
+// DeleteChirp mirrors the reply_count trigger, the ON DELETE SET NULL
+// constraint on reply_to and the cascade to likes, rechirps, moderation
+// flags and revisions.
+func (m *Memory) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[id]
+	if !ok {
+		return nil
+	}
+	delete(m.chirps, id)
+	delete(m.revisions, id)
+	for key := range m.likes {
+		if key.chirp == id {
+			delete(m.likes, key)
+		}
+	}
+	for key := range m.rechirps {
+		if key.chirp == id {
+			delete(m.rechirps, key)
+		}
+	}
+	for flagID, flag := range m.flags {
+		if flag.ChirpID == id {
+			delete(m.flags, flagID)
+		}
+	}
+	if parent, ok := m.chirps[chirp.ReplyTo.UUID]; chirp.ReplyTo.Valid && ok {
+		parent.ReplyCount--
+		m.chirps[parent.ID] = parent
+	}
+	for replyID, reply := range m.chirps {
+		if reply.ReplyTo.Valid && reply.ReplyTo.UUID == id {
+			reply.ReplyTo = uuid.NullUUID{}
+			m.chirps[replyID] = reply
+		}
+	}
+	return nil
+}
+
+// TombstoneChirp also drops the chirp's revisions so no prior body survives.
+func (m *Memory) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[id]
+	if !ok {
+		return nil
+	}
+	delete(m.revisions, id)
+	t := now()
+	chirp.Body = ""
+	chirp.DeletedAt = sql.NullTime{Time: t, Valid: true}
+	chirp.UpdatedAt = t
+	m.chirps[id] = chirp
+	return nil
+}
+
+func (m *Memory) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []database.Chirp{}
+	chirp, ok := m.chirps[id]
+	for ok && chirp.ReplyTo.Valid {
+		chirp, ok = m.chirps[chirp.ReplyTo.UUID]
+		if ok {
+			items = append([]database.Chirp{chirp}, items...)
+		}
+	}
+	return items, nil
+}
+
+func (m *Memory) GetChirpDescendants(ctx context.Context, arg database.GetChirpDescendantsParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []database.Chirp{}
+	level := []uuid.UUID{arg.ID}
+	for depth := int32(1); depth <= arg.MaxDepth && len(level) > 0; depth++ {
+		next := []uuid.UUID{}
+		for _, chirp := range m.chirps {
+			for _, parent := range level {
+				if chirp.ReplyTo.Valid && chirp.ReplyTo.UUID == parent {
+					items = append(items, chirp)
+					next = append(next, chirp.ID)
+				}
+			}
+		}
+		level = next
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return compareKeyset(items[i].CreatedAt, items[i].ID, items[j].CreatedAt, items[j].ID) < 0
+	})
+	if len(items) > int(arg.Limit) {
+		items = items[:arg.Limit]
+	}
+	return items, nil
+}
+
+func (m *Memory) CreateToken(ctx context.Context, arg database.CreateTokenParams) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tokens[arg.Token]; ok {
+		return database.RefreshToken{}, ErrUniqueViolation
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.RefreshToken{}, ErrForeignKeyViolation
+	}
+	t := now()
+	token := database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: t,
+		UpdatedAt: t,
+		UserID:    arg.UserID,
+		ExpiresAt: t.Add(refreshTokenLifetime),
+		FamilyID:  arg.FamilyID,
+
+		SessionStartedAt: t,
+		UserAgent:        arg.UserAgent,
+		IP:               arg.IP,
+	}
+	m.tokens[token.Token] = token
+	return token, nil
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.tokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+// RotateRefreshToken retires an active token and issues its successor in the
+// same family in one step, like the query's CTE. It misses when the old token
+// is unknown, revoked or expired.
+func (m *Memory) RotateRefreshToken(ctx context.Context, arg database.RotateRefreshTokenParams) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.tokens[arg.OldToken]
+	t := now()
+	if !ok || old.RevokedAt.Valid || !old.ExpiresAt.After(t) {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	if _, ok := m.tokens[arg.NewToken]; ok {
+		return database.RefreshToken{}, ErrUniqueViolation
+	}
+	old.RevokedAt = sql.NullTime{Time: t, Valid: true}
+	old.RotatedAt = sql.NullTime{Time: t, Valid: true}
+	old.UpdatedAt = t
+	m.tokens[old.Token] = old
+	token := database.RefreshToken{
+		Token:     arg.NewToken,
+		CreatedAt: t,
+		UpdatedAt: t,
+		UserID:    old.UserID,
+		ExpiresAt: t.Add(refreshTokenLifetime),
+		FamilyID:  old.FamilyID,
+
+		SessionStartedAt: old.SessionStartedAt,
+		UserAgent:        arg.UserAgent,
+		IP:               arg.IP,
+	}
+	m.tokens[token.Token] = token
+	return token, nil
+}
+
+func (m *Memory) RevokeToken(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[token]
+	if !ok || t.RevokedAt.Valid {
+		return nil
+	}
+	n := now()
+	t.RevokedAt = sql.NullTime{Time: n, Valid: true}
+	t.UpdatedAt = n
+	m.tokens[token] = t
+	return nil
+}
+
+func (m *Memory) RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	for key, token := range m.tokens {
+		if token.FamilyID == familyID && !token.RevokedAt.Valid {
+			token.RevokedAt = sql.NullTime{Time: t, Valid: true}
+			token.UpdatedAt = t
+			m.tokens[key] = token
+		}
+	}
+	return nil
+}
+
+// ListSessions returns the active token of each of userID's live families,
+// most recently used first.
+func (m *Memory) ListSessions(ctx context.Context, userID uuid.UUID) ([]database.ListSessionsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t := now()
+	rows := []database.ListSessionsRow{}
+	for _, token := range m.tokens {
+		if token.UserID != userID || token.RevokedAt.Valid || !token.ExpiresAt.After(t) {
+			continue
+		}
+		rows = append(rows, database.ListSessionsRow{
+			FamilyID:         token.FamilyID,
+			SessionStartedAt: token.SessionStartedAt,
+			LastUsedAt:       token.CreatedAt,
+			UserAgent:        token.UserAgent,
+			IP:               token.IP,
+			ExpiresAt:        token.ExpiresAt,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return compareKeyset(rows[i].LastUsedAt, rows[i].FamilyID, rows[j].LastUsedAt, rows[j].FamilyID) > 0
+	})
+	return rows, nil
+}
+
+func (m *Memory) CountActiveSessions(ctx context.Context) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t := now()
+	var n int64
+	for _, token := range m.tokens {
+		if !token.RevokedAt.Valid && token.ExpiresAt.After(t) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// RevokeSession revokes the active token of one of a user's families and
+// reports how many tokens it revoked, so zero means no such live session.
+func (m *Memory) RevokeSession(ctx context.Context, arg database.RevokeSessionParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	var n int64
+	for key, token := range m.tokens {
+		if token.FamilyID != arg.FamilyID || token.UserID != arg.UserID || token.RevokedAt.Valid || !token.ExpiresAt.After(t) {
+			continue
+		}
+		token.RevokedAt = sql.NullTime{Time: t, Valid: true}
+		token.UpdatedAt = t
+		m.tokens[key] = token
+		n++
+	}
+	return n, nil
+}
+
+func (m *Memory) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	for key, token := range m.tokens {
+		if token.UserID == userID && !token.RevokedAt.Valid {
+			token.RevokedAt = sql.NullTime{Time: t, Valid: true}
+			token.UpdatedAt = t
+			m.tokens[key] = token
+		}
+	}
+	return nil
+}
+
+// emailTaken reports whether a user other than except already uses email.
+// Callers must hold m.mu.
+func (m *Memory) emailTaken(email string, except uuid.UUID) bool {
+	for id, user := range m.users {
+		if id != except && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// compareKeyset orders rows the way Postgres compares (created_at, id) tuples.
+func compareKeyset(aTime time.Time, aID uuid.UUID, bTime time.Time, bID uuid.UUID) int {
+	if c := aTime.Compare(bTime); c != 0 {
+		return c
+	}
+	return bytes.Compare(aID[:], bID[:])
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *Memory) ListUsers(ctx context.Context, arg database.ListUsersParams) ([]database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []database.User{}
+	for _, user := range m.users {
+		if arg.Email.Valid && !strings.Contains(strings.ToLower(user.Email), strings.ToLower(arg.Email.String)) {
+			continue
+		}
+		if arg.CursorCreatedAt.Valid && compareKeyset(user.CreatedAt, user.ID, arg.CursorCreatedAt.Time, arg.CursorID.UUID) >= 0 {
+			continue
+		}
+		items = append(items, user)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return compareKeyset(items[i].CreatedAt, items[i].ID, items[j].CreatedAt, items[j].ID) > 0
+	})
+	if len(items) > int(arg.Limit) {
+		items = items[:arg.Limit]
+	}
+	return items, nil
+}
+
+// DisableUser keeps the original disabled_at when the user is already
+// disabled, like the query's COALESCE.
+func (m *Memory) DisableUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	t := now()
+	if !user.DisabledAt.Valid {
+		user.DisabledAt = sql.NullTime{Time: t, Valid: true}
+	}
+	user.UpdatedAt = t
+	m.users[id] = user
+	return user, nil
+}
+
+func (m *Memory) EnableUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.DisabledAt = sql.NullTime{}
+	user.UpdatedAt = now()
+	m.users[id] = user
+	return user, nil
+}
+
+func (m *Memory) SetChirpyRed(ctx context.Context, arg database.SetChirpyRedParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.IsChirpyRed = arg.IsChirpyRed
+	user.UpdatedAt = now()
+	m.users[arg.ID] = user
+	return user, nil
+}
+
+func (m *Memory) CreateAuditLogEntry(ctx context.Context, arg database.CreateAuditLogEntryParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if arg.ActorUserID.Valid {
+		if _, ok := m.users[arg.ActorUserID.UUID]; !ok {
+			return ErrForeignKeyViolation
+		}
+	}
+	details := arg.Details
+	if details == nil {
+		details = json.RawMessage("{}")
+	}
+	entry := database.AdminAuditLog{
+		ID:          uuid.New(),
+		CreatedAt:   now(),
+		ActorUserID: arg.ActorUserID,
+		Actor:       arg.Actor,
+		Action:      arg.Action,
+		TargetType:  arg.TargetType,
+		TargetID:    arg.TargetID,
+		Details:     details,
+	}
+	m.audit[entry.ID] = entry
+	return nil
+}
+
+func (m *Memory) ListAuditLog(ctx context.Context, arg database.ListAuditLogParams) ([]database.AdminAuditLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []database.AdminAuditLog{}
+	for _, entry := range m.audit {
+		if arg.CursorCreatedAt.Valid && compareKeyset(entry.CreatedAt, entry.ID, arg.CursorCreatedAt.Time, arg.CursorID.UUID) >= 0 {
+			continue
+		}
+		items = append(items, entry)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return compareKeyset(items[i].CreatedAt, items[i].ID, items[j].CreatedAt, items[j].ID) > 0
+	})
+	if len(items) > int(arg.Limit) {
+		items = items[:arg.Limit]
+	}
+	return items, nil
+}
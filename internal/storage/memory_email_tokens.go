@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+)
+
+func (m *Memory) CreateEmailToken(ctx context.Context, arg database.CreateEmailTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.emailTokens[arg.TokenHash]; ok {
+		return ErrUniqueViolation
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return ErrForeignKeyViolation
+	}
+	t := now()
+	m.emailTokens[arg.TokenHash] = database.EmailToken{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		Email:     arg.Email,
+		Purpose:   arg.Purpose,
+		CreatedAt: t,
+		ExpiresAt: t.Add(time.Duration(arg.TtlMinutes) * time.Minute),
+	}
+	return nil
+}
+
+func (m *Memory) InvalidateEmailTokens(ctx context.Context, arg database.InvalidateEmailTokensParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	for hash, token := range m.emailTokens {
+		if token.UserID == arg.UserID && token.Purpose == arg.Purpose && !token.UsedAt.Valid {
+			token.UsedAt = sql.NullTime{Time: t, Valid: true}
+			m.emailTokens[hash] = token
+		}
+	}
+	return nil
+}
+
+// ConsumeEmailToken marks an unused, unexpired token as used. Like the
+// query, anything else misses with sql.ErrNoRows.
+func (m *Memory) ConsumeEmailToken(ctx context.Context, arg database.ConsumeEmailTokenParams) (database.ConsumeEmailTokenRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.emailTokens[arg.TokenHash]
+	t := now()
+	if !ok || token.Purpose != arg.Purpose || token.UsedAt.Valid || !token.ExpiresAt.After(t) {
+		return database.ConsumeEmailTokenRow{}, sql.ErrNoRows
+	}
+	token.UsedAt = sql.NullTime{Time: t, Valid: true}
+	m.emailTokens[arg.TokenHash] = token
+	return database.ConsumeEmailTokenRow{UserID: token.UserID, Email: token.Email}, nil
+}
+
+func (m *Memory) VerifyUserEmail(ctx context.Context, arg database.VerifyUserEmailParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[arg.ID]
+	if !ok || user.Email != arg.Email {
+		return 0, nil
+	}
+	t := now()
+	if !user.EmailVerifiedAt.Valid {
+		user.EmailVerifiedAt = sql.NullTime{Time: t, Valid: true}
+	}
+	user.UpdatedAt = t
+	m.users[user.ID] = user
+	return 1, nil
+}
+
+func (m *Memory) ResetUserPassword(ctx context.Context, arg database.ResetUserPasswordParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[arg.ID]
+	if !ok || user.Email != arg.Email {
+		return 0, nil
+	}
+	t := now()
+	if !user.EmailVerifiedAt.Valid {
+		user.EmailVerifiedAt = sql.NullTime{Time: t, Valid: true}
+	}
+	user.HashedPassword = arg.HashedPassword
+	user.UpdatedAt = t
+	m.users[user.ID] = user
+	return 1, nil
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+type engagementKey struct {
+	user  uuid.UUID
+	chirp uuid.UUID
+}
+
+// LikeChirp and the other engagement methods keep like_count and
+// rechirp_count in step the way the Postgres triggers do.
+func (m *Memory) LikeChirp(ctx context.Context, arg database.LikeChirpParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, err := m.engagementTarget(arg.UserID, arg.ChirpID)
+	if err != nil {
+		return err
+	}
+	key := engagementKey{arg.UserID, arg.ChirpID}
+	if _, ok := m.likes[key]; ok {
+		return nil
+	}
+	m.likes[key] = database.ChirpLike{UserID: arg.UserID, ChirpID: arg.ChirpID, CreatedAt: now()}
+	chirp.LikeCount++
+	m.chirps[chirp.ID] = chirp
+	return nil
+}
+
+func (m *Memory) UnlikeChirp(ctx context.Context, arg database.UnlikeChirpParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := engagementKey{arg.UserID, arg.ChirpID}
+	if _, ok := m.likes[key]; !ok {
+		return nil
+	}
+	delete(m.likes, key)
+	if chirp, ok := m.chirps[arg.ChirpID]; ok {
+		chirp.LikeCount--
+		m.chirps[chirp.ID] = chirp
+	}
+	return nil
+}
+
+func (m *Memory) ListLikedChirpIDs(ctx context.Context, arg database.ListLikedChirpIDsParams) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []uuid.UUID{}
+	for _, id := range arg.ChirpIds {
+		if _, ok := m.likes[engagementKey{arg.UserID, id}]; ok {
+			items = append(items, id)
+		}
+	}
+	return items, nil
+}
+
+func (m *Memory) RechirpChirp(ctx context.Context, arg database.RechirpChirpParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, err := m.engagementTarget(arg.UserID, arg.ChirpID)
+	if err != nil {
+		return err
+	}
+	key := engagementKey{arg.UserID, arg.ChirpID}
+	if _, ok := m.rechirps[key]; ok {
+		return nil
+	}
+	m.rechirps[key] = database.Rechirp{UserID: arg.UserID, ChirpID: arg.ChirpID, CreatedAt: now()}
+	chirp.RechirpCount++
+	m.chirps[chirp.ID] = chirp
+	return nil
+}
+
+// engagementTarget checks the foreign keys of a like or rechirp. Callers must
+// hold m.mu.
+func (m *Memory) engagementTarget(userID, chirpID uuid.UUID) (database.Chirp, error) {
+	if _, ok := m.users[userID]; !ok {
+		return database.Chirp{}, ErrForeignKeyViolation
+	}
+	chirp, ok := m.chirps[chirpID]
+	if !ok {
+		return database.Chirp{}, ErrForeignKeyViolation
+	}
+	return chirp, nil
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+// ErrCheckViolation is returned by Memory where Postgres would raise a check
+// constraint violation.
+var ErrCheckViolation = errors.New("storage: check constraint violation")
+
+type followKey struct {
+	follower uuid.UUID
+	followee uuid.UUID
+}
+
+func (m *Memory) FollowUser(ctx context.Context, arg database.FollowUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if arg.FollowerID == arg.FolloweeID {
+		return ErrCheckViolation
+	}
+	if _, ok := m.users[arg.FollowerID]; !ok {
+		return ErrForeignKeyViolation
+	}
+	if _, ok := m.users[arg.FolloweeID]; !ok {
+		return ErrForeignKeyViolation
+	}
+	key := followKey{arg.FollowerID, arg.FolloweeID}
+	if _, ok := m.follows[key]; ok {
+		return nil
+	}
+	m.follows[key] = database.Follow{
+		FollowerID: arg.FollowerID,
+		FolloweeID: arg.FolloweeID,
+		CreatedAt:  now(),
+	}
+	return nil
+}
+
+func (m *Memory) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.follows, followKey{arg.FollowerID, arg.FolloweeID})
+	return nil
+}
+
+func (m *Memory) ListFollowers(ctx context.Context, arg database.ListFollowersParams) ([]database.ListFollowersRow, error) {
+	page := m.listFollows(database.ListFollowingParams(arg), func(f database.Follow) (uuid.UUID, uuid.UUID) {
+		return f.FolloweeID, f.FollowerID
+	})
+	items := []database.ListFollowersRow{}
+	for _, f := range page {
+		items = append(items, database.ListFollowersRow{FollowerID: f.FollowerID, CreatedAt: f.CreatedAt})
+	}
+	return items, nil
+}
+
+func (m *Memory) ListFollowing(ctx context.Context, arg database.ListFollowingParams) ([]database.ListFollowingRow, error) {
+	page := m.listFollows(arg, func(f database.Follow) (uuid.UUID, uuid.UUID) {
+		return f.FollowerID, f.FolloweeID
+	})
+	items := []database.ListFollowingRow{}
+	for _, f := range page {
+		items = append(items, database.ListFollowingRow{FolloweeID: f.FolloweeID, CreatedAt: f.CreatedAt})
+	}
+	return items, nil
+}
+
+// listFollows returns one page of follows, newest first. side maps a follow to
+// the user it is listed under and the user that is listed.
+func (m *Memory) listFollows(arg database.ListFollowingParams, side func(database.Follow) (uuid.UUID, uuid.UUID)) []database.Follow {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []database.Follow{}
+	for _, f := range m.follows {
+		owner, listed := side(f)
+		if owner != arg.UserID {
+			continue
+		}
+		if arg.CursorCreatedAt.Valid && compareKeyset(f.CreatedAt, listed, arg.CursorCreatedAt.Time, arg.CursorID.UUID) >= 0 {
+			continue
+		}
+		items = append(items, f)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		_, a := side(items[i])
+		_, b := side(items[j])
+		return compareKeyset(items[i].CreatedAt, a, items[j].CreatedAt, b) > 0
+	})
+	if len(items) > int(arg.Limit) {
+		items = items[:arg.Limit]
+	}
+	return items
+}
+
+func (m *Memory) ListTimeline(ctx context.Context, arg database.ListTimelineParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []database.Chirp{}
+	for _, chirp := range m.chirps {
+		if chirp.DeletedAt.Valid {
+			continue
+		}
+		if _, ok := m.follows[followKey{arg.UserID, chirp.UserID}]; !ok {
+			continue
+		}
+		if arg.CursorCreatedAt.Valid && compareKeyset(chirp.CreatedAt, chirp.ID, arg.CursorCreatedAt.Time, arg.CursorID.UUID) >= 0 {
+			continue
+		}
+		items = append(items, chirp)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return compareKeyset(items[i].CreatedAt, items[i].ID, items[j].CreatedAt, items[j].ID) > 0
+	})
+	if len(items) > int(arg.Limit) {
+		items = items[:arg.Limit]
+	}
+	return items, nil
+}
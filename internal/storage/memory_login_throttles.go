@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+type throttleKey struct {
+	scope   string
+	subject string
+}
+
+func (m *Memory) GetLoginLock(ctx context.Context, arg database.GetLoginLockParams) (sql.NullTime, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t := now()
+	var locked sql.NullTime
+	for _, key := range []throttleKey{{"account", arg.Email}, {"ip", arg.IP}} {
+		row, ok := m.throttles[key]
+		if ok && row.LockedUntil.Valid && row.LockedUntil.Time.After(t) && (!locked.Valid || row.LockedUntil.Time.After(locked.Time)) {
+			locked = row.LockedUntil
+		}
+	}
+	if !locked.Valid {
+		return sql.NullTime{}, sql.ErrNoRows
+	}
+	return locked, nil
+}
+
+func (m *Memory) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (int32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := throttleKey{arg.Scope, arg.Subject}
+	t := now()
+	row, ok := m.throttles[key]
+	if !ok {
+		row = database.LoginThrottle{Scope: arg.Scope, Subject: arg.Subject}
+	}
+	if ok && row.LastFailureAt.Before(t.Add(-time.Duration(arg.WindowSeconds)*time.Second)) {
+		row.Failures = 1
+	} else {
+		row.Failures++
+	}
+	row.LastFailureAt = t
+	m.throttles[key] = row
+	return row.Failures, nil
+}
+
+func (m *Memory) LockLogin(ctx context.Context, arg database.LockLoginParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := throttleKey{arg.Scope, arg.Subject}
+	row, ok := m.throttles[key]
+	if !ok {
+		return nil
+	}
+	row.LockedUntil = sql.NullTime{Time: now().Add(time.Duration(arg.LockSeconds) * time.Second), Valid: true}
+	m.throttles[key] = row
+	return nil
+}
+
+func (m *Memory) ClearLoginFailures(ctx context.Context, arg database.ClearLoginFailuresParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.throttles, throttleKey{arg.Scope, arg.Subject})
+	return nil
+}
+
+func (m *Memory) ListLoginLocks(ctx context.Context) ([]database.ListLoginLocksRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t := now()
+	var items []database.ListLoginLocksRow
+	for _, row := range m.throttles {
+		if !row.LockedUntil.Valid || !row.LockedUntil.Time.After(t) {
+			continue
+		}
+		item := database.ListLoginLocksRow{
+			Scope:         row.Scope,
+			Subject:       row.Subject,
+			Failures:      row.Failures,
+			LastFailureAt: row.LastFailureAt,
+			LockedUntil:   row.LockedUntil,
+		}
+		if row.Scope == "account" {
+			for _, user := range m.users {
+				if user.Email == row.Subject {
+					item.UserID = uuid.NullUUID{UUID: user.ID, Valid: true}
+					break
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if !a.LockedUntil.Time.Equal(b.LockedUntil.Time) {
+			return a.LockedUntil.Time.After(b.LockedUntil.Time)
+		}
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		return a.Subject < b.Subject
+	})
+	return items, nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *Memory) ListProfaneWords(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []string{}
+	for word := range m.words {
+		items = append(items, word)
+	}
+	sort.Strings(items)
+	return items, nil
+}
+
+func (m *Memory) AddProfaneWord(ctx context.Context, word string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.words[word]; !ok {
+		m.words[word] = database.ProfaneWord{Word: word, CreatedAt: now()}
+	}
+	return nil
+}
+
+func (m *Memory) RemoveProfaneWord(ctx context.Context, word string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.words, word)
+	return nil
+}
+
+func (m *Memory) CreateModerationFlag(ctx context.Context, arg database.CreateModerationFlagParams) (database.ModerationFlag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.chirps[arg.ChirpID]; !ok {
+		return database.ModerationFlag{}, ErrForeignKeyViolation
+	}
+	flag := database.ModerationFlag{
+		ID:        uuid.New(),
+		ChirpID:   arg.ChirpID,
+		Words:     append([]string{}, arg.Words...),
+		CreatedAt: now(),
+	}
+	m.flags[flag.ID] = flag
+	return flag, nil
+}
+
+func (m *Memory) ListModerationFlags(ctx context.Context, arg database.ListModerationFlagsParams) ([]database.ModerationFlag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []database.ModerationFlag{}
+	for _, flag := range m.flags {
+		if arg.CursorCreatedAt.Valid && compareKeyset(flag.CreatedAt, flag.ID, arg.CursorCreatedAt.Time, arg.CursorID.UUID) >= 0 {
+			continue
+		}
+		items = append(items, flag)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return compareKeyset(items[i].CreatedAt, items[i].ID, items[j].CreatedAt, items[j].ID) > 0
+	})
+	if len(items) > int(arg.Limit) {
+		items = items[:arg.Limit]
+	}
+	return items, nil
+}
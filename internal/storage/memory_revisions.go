@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+// EditChirp stores the current body as a revision stamped with the chirp's
+// updated_at, then replaces it. Like the query, it misses on tombstones.
+func (m *Memory) EditChirp(ctx context.Context, arg database.EditChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[arg.ID]
+	if !ok || chirp.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	m.revisions[chirp.ID] = append(m.revisions[chirp.ID], database.ChirpRevision{
+		ID:        uuid.New(),
+		ChirpID:   chirp.ID,
+		Body:      chirp.Body,
+		CreatedAt: chirp.UpdatedAt,
+	})
+	t := now()
+	chirp.Body = arg.Body
+	chirp.UpdatedAt = t
+	chirp.EditedAt = sql.NullTime{Time: t, Valid: true}
+	m.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored := m.revisions[chirpID]
+	revisions := make([]database.ChirpRevision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revisions = append(revisions, stored[i])
+	}
+	return revisions, nil
+}
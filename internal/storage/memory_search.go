@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+// SearchChirps approximates the Postgres full-text query: every query word
+// must appear in the body (case-insensitive, no stemming or stop words), rank
+// is the share of body words that matched, and matches are wrapped in
+// HighlightStart and HighlightStop like ts_headline.
+func (m *Memory) SearchChirps(ctx context.Context, arg database.SearchChirpsParams) ([]database.SearchChirpsRow, error) {
+	terms := map[string]struct{}{}
+	for _, word := range searchWords(arg.Query) {
+		terms[word] = struct{}{}
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []database.SearchChirpsRow{}
+	for _, chirp := range m.chirps {
+		if chirp.DeletedAt.Valid {
+			continue
+		}
+		if arg.AuthorID.Valid && chirp.UserID != arg.AuthorID.UUID {
+			continue
+		}
+		words := searchWords(chirp.Body)
+		found := map[string]struct{}{}
+		matched := 0
+		for _, word := range words {
+			if _, ok := terms[word]; ok {
+				found[word] = struct{}{}
+				matched++
+			}
+		}
+		if len(found) != len(terms) {
+			continue
+		}
+		row := database.SearchChirpsRow{
+			ID:           chirp.ID,
+			CreatedAt:    chirp.CreatedAt,
+			UpdatedAt:    chirp.UpdatedAt,
+			Body:         chirp.Body,
+			UserID:       chirp.UserID,
+			ReplyTo:      chirp.ReplyTo,
+			ReplyCount:   chirp.ReplyCount,
+			LikeCount:    chirp.LikeCount,
+			RechirpCount: chirp.RechirpCount,
+			EditedAt:     chirp.EditedAt,
+			Rank:         float32(matched) / float32(len(words)),
+			Snippet:      highlight(chirp.Body, terms),
+		}
+		if arg.CursorRank.Valid && compareSearchRow(row, float32(arg.CursorRank.Float64), arg.CursorCreatedAt.Time, arg.CursorID.UUID) >= 0 {
+			continue
+		}
+		items = append(items, row)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return compareSearchRow(items[i], items[j].Rank, items[j].CreatedAt, items[j].ID) < 0
+	})
+	if len(items) > int(arg.Limit) {
+		items = items[:arg.Limit]
+	}
+	return items, nil
+}
+
+// compareSearchRow orders rows by rank, created_at and id, all descending, so
+// a negative result means row sorts first.
+func compareSearchRow(row database.SearchChirpsRow, rank float32, createdAt time.Time, id uuid.UUID) int {
+	if row.Rank != rank {
+		if row.Rank > rank {
+			return -1
+		}
+		return 1
+	}
+	return -compareKeyset(row.CreatedAt, row.ID, createdAt, id)
+}
+
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func highlight(body string, terms map[string]struct{}) string {
+	var b strings.Builder
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		if _, ok := terms[strings.ToLower(string(word))]; ok {
+			b.WriteString(HighlightStart + string(word) + HighlightStop)
+		} else {
+			b.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+	body = strings.NewReplacer(HighlightStart, "", HighlightStop, "").Replace(body)
+	for _, r := range body {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+	return b.String()
+}
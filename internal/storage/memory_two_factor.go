@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	loginChallengeLifetime    = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+)
+
+func (m *Memory) GetUserTOTP(ctx context.Context, userID uuid.UUID) (database.UserTotp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	totp, ok := m.totp[userID]
+	if !ok {
+		return database.UserTotp{}, sql.ErrNoRows
+	}
+	return totp, nil
+}
+
+// SetUserTOTPSecret starts or restarts enrollment. Like the upsert, it leaves
+// a confirmed secret alone and reports 0 rows.
+func (m *Memory) SetUserTOTPSecret(ctx context.Context, arg database.SetUserTOTPSecretParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return 0, ErrForeignKeyViolation
+	}
+	if totp, ok := m.totp[arg.UserID]; ok && totp.EnabledAt.Valid {
+		return 0, nil
+	}
+	m.totp[arg.UserID] = database.UserTotp{
+		UserID:    arg.UserID,
+		Secret:    arg.Secret,
+		CreatedAt: now(),
+	}
+	return 1, nil
+}
+
+func (m *Memory) EnableUserTOTP(ctx context.Context, arg database.EnableUserTOTPParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	totp, ok := m.totp[arg.UserID]
+	if !ok || totp.EnabledAt.Valid {
+		return 0, nil
+	}
+	totp.EnabledAt = sql.NullTime{Time: now(), Valid: true}
+	totp.LastCounter = arg.LastCounter
+	m.totp[arg.UserID] = totp
+	return 1, nil
+}
+
+func (m *Memory) AdvanceTOTPCounter(ctx context.Context, arg database.AdvanceTOTPCounterParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	totp, ok := m.totp[arg.UserID]
+	if !ok || !totp.EnabledAt.Valid || totp.LastCounter >= arg.LastCounter {
+		return 0, nil
+	}
+	totp.LastCounter = arg.LastCounter
+	m.totp[arg.UserID] = totp
+	return 1, nil
+}
+
+// DeleteUserTOTP also drops the user's recovery codes, as the foreign key
+// cascade does.
+func (m *Memory) DeleteUserTOTP(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.totp[userID]; !ok {
+		return 0, nil
+	}
+	delete(m.totp, userID)
+	delete(m.recoveryCodes, userID)
+	return 1, nil
+}
+
+func (m *Memory) CreateRecoveryCodes(ctx context.Context, arg database.CreateRecoveryCodesParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.totp[arg.UserID]; !ok {
+		return ErrForeignKeyViolation
+	}
+	codes := m.recoveryCodes[arg.UserID]
+	if codes == nil {
+		codes = map[string]database.RecoveryCode{}
+	}
+	for _, hash := range arg.CodeHashes {
+		if _, ok := codes[hash]; ok {
+			return ErrUniqueViolation
+		}
+	}
+	t := now()
+	for _, hash := range arg.CodeHashes {
+		codes[hash] = database.RecoveryCode{UserID: arg.UserID, CodeHash: hash, CreatedAt: t}
+	}
+	m.recoveryCodes[arg.UserID] = codes
+	return nil
+}
+
+func (m *Memory) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+func (m *Memory) UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.recoveryCodes[arg.UserID][arg.CodeHash]
+	if !ok || code.UsedAt.Valid {
+		return 0, nil
+	}
+	code.UsedAt = sql.NullTime{Time: now(), Valid: true}
+	m.recoveryCodes[arg.UserID][arg.CodeHash] = code
+	return 1, nil
+}
+
+func (m *Memory) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var count int64
+	for _, code := range m.recoveryCodes[userID] {
+		if !code.UsedAt.Valid {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) CreateLoginChallenge(ctx context.Context, arg database.CreateLoginChallengeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.challenges[arg.TokenHash]; ok {
+		return ErrUniqueViolation
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return ErrForeignKeyViolation
+	}
+	t := now()
+	m.challenges[arg.TokenHash] = database.LoginChallenge{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		CreatedAt: t,
+		ExpiresAt: t.Add(loginChallengeLifetime),
+	}
+	return nil
+}
+
+// liveChallenge returns the challenge if it can still be answered. The
+// caller must hold m.mu.
+func (m *Memory) liveChallenge(tokenHash string) (database.LoginChallenge, bool) {
+	c, ok := m.challenges[tokenHash]
+	if !ok || c.UsedAt.Valid || !c.ExpiresAt.After(now()) || c.Attempts >= loginChallengeMaxAttempts {
+		return database.LoginChallenge{}, false
+	}
+	return c, true
+}
+
+func (m *Memory) GetLoginChallenge(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.liveChallenge(tokenHash)
+	if !ok {
+		return uuid.Nil, sql.ErrNoRows
+	}
+	return c.UserID, nil
+}
+
+func (m *Memory) FailLoginChallenge(ctx context.Context, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.challenges[tokenHash]; ok {
+		c.Attempts++
+		m.challenges[tokenHash] = c
+	}
+	return nil
+}
+
+func (m *Memory) ConsumeLoginChallenge(ctx context.Context, tokenHash string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.liveChallenge(tokenHash)
+	if !ok {
+		return 0, nil
+	}
+	c.UsedAt = sql.NullTime{Time: now(), Valid: true}
+	m.challenges[tokenHash] = c
+	return 1, nil
+}
@@ -0,0 +1,122 @@
+// Package storage defines the persistence interface used by the HTTP
+// handlers, along with an in-memory implementation for tests and local runs.
+// The sqlc-generated *database.Queries is the Postgres-backed implementation.
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+// Store covers every query the API needs for users, chirps, likes,
+// rechirps, moderation, follows, email tokens, login throttling, two-factor
+// authentication, the admin API and refresh tokens. Method signatures mirror the sqlc-generated queries so that
+// *database.Queries satisfies it without an adapter.
+type Store interface {
+	// Users
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error)
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	UpdateUserLogin(ctx context.Context, arg database.UpdateUserLoginParams) (database.UpdateUserLoginRow, error)
+	UpgradeUser(ctx context.Context, id uuid.UUID) error
+	SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.SetUserRoleRow, error)
+	ResetUsers(ctx context.Context) error
+
+	// Chirps
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error)
+	ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error)
+	DeleteChirp(ctx context.Context, id uuid.UUID) error
+	TombstoneChirp(ctx context.Context, id uuid.UUID) error
+	GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.Chirp, error)
+	GetChirpDescendants(ctx context.Context, arg database.GetChirpDescendantsParams) ([]database.Chirp, error)
+	SearchChirps(ctx context.Context, arg database.SearchChirpsParams) ([]database.SearchChirpsRow, error)
+
+	// Revisions
+	EditChirp(ctx context.Context, arg database.EditChirpParams) (database.Chirp, error)
+	ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error)
+
+	// Likes and rechirps
+	LikeChirp(ctx context.Context, arg database.LikeChirpParams) error
+	UnlikeChirp(ctx context.Context, arg database.UnlikeChirpParams) error
+	ListLikedChirpIDs(ctx context.Context, arg database.ListLikedChirpIDsParams) ([]uuid.UUID, error)
+	RechirpChirp(ctx context.Context, arg database.RechirpChirpParams) error
+
+	// Moderation
+	ListProfaneWords(ctx context.Context) ([]string, error)
+	AddProfaneWord(ctx context.Context, word string) error
+	RemoveProfaneWord(ctx context.Context, word string) error
+	CreateModerationFlag(ctx context.Context, arg database.CreateModerationFlagParams) (database.ModerationFlag, error)
+	ListModerationFlags(ctx context.Context, arg database.ListModerationFlagsParams) ([]database.ModerationFlag, error)
+
+	// Follows
+	FollowUser(ctx context.Context, arg database.FollowUserParams) error
+	UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error
+	ListFollowers(ctx context.Context, arg database.ListFollowersParams) ([]database.ListFollowersRow, error)
+	ListFollowing(ctx context.Context, arg database.ListFollowingParams) ([]database.ListFollowingRow, error)
+	ListTimeline(ctx context.Context, arg database.ListTimelineParams) ([]database.Chirp, error)
+
+	// Email tokens
+	CreateEmailToken(ctx context.Context, arg database.CreateEmailTokenParams) error
+	InvalidateEmailTokens(ctx context.Context, arg database.InvalidateEmailTokensParams) error
+	ConsumeEmailToken(ctx context.Context, arg database.ConsumeEmailTokenParams) (database.ConsumeEmailTokenRow, error)
+	VerifyUserEmail(ctx context.Context, arg database.VerifyUserEmailParams) (int64, error)
+	ResetUserPassword(ctx context.Context, arg database.ResetUserPasswordParams) (int64, error)
+
+	// Login throttling
+	GetLoginLock(ctx context.Context, arg database.GetLoginLockParams) (sql.NullTime, error)
+	RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (int32, error)
+	LockLogin(ctx context.Context, arg database.LockLoginParams) error
+	ClearLoginFailures(ctx context.Context, arg database.ClearLoginFailuresParams) error
+	ListLoginLocks(ctx context.Context) ([]database.ListLoginLocksRow, error)
+
+	// Two-factor authentication
+	GetUserTOTP(ctx context.Context, userID uuid.UUID) (database.UserTotp, error)
+	SetUserTOTPSecret(ctx context.Context, arg database.SetUserTOTPSecretParams) (int64, error)
+	EnableUserTOTP(ctx context.Context, arg database.EnableUserTOTPParams) (int64, error)
+	AdvanceTOTPCounter(ctx context.Context, arg database.AdvanceTOTPCounterParams) (int64, error)
+	DeleteUserTOTP(ctx context.Context, userID uuid.UUID) (int64, error)
+	CreateRecoveryCodes(ctx context.Context, arg database.CreateRecoveryCodesParams) error
+	DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error
+	UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error)
+	CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error)
+	CreateLoginChallenge(ctx context.Context, arg database.CreateLoginChallengeParams) error
+	GetLoginChallenge(ctx context.Context, tokenHash string) (uuid.UUID, error)
+	FailLoginChallenge(ctx context.Context, tokenHash string) error
+	ConsumeLoginChallenge(ctx context.Context, tokenHash string) (int64, error)
+
+	// Admin
+	ListUsers(ctx context.Context, arg database.ListUsersParams) ([]database.User, error)
+	DisableUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	EnableUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	SetChirpyRed(ctx context.Context, arg database.SetChirpyRedParams) (database.User, error)
+	CreateAuditLogEntry(ctx context.Context, arg database.CreateAuditLogEntryParams) error
+	ListAuditLog(ctx context.Context, arg database.ListAuditLogParams) ([]database.AdminAuditLog, error)
+
+	// Refresh tokens
+	CreateToken(ctx context.Context, arg database.CreateTokenParams) (database.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, arg database.RotateRefreshTokenParams) (database.RefreshToken, error)
+	RevokeToken(ctx context.Context, token string) error
+	RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]database.ListSessionsRow, error)
+	RevokeSession(ctx context.Context, arg database.RevokeSessionParams) (int64, error)
+	CountActiveSessions(ctx context.Context) (int64, error)
+	RevokeUserTokens(ctx context.Context, userID uuid.UUID) error
+}
+
+// SearchChirps returns snippets as plain text with each match between
+// HighlightStart and HighlightStop. They are private-use characters,
+// stripped from the body first, so text in a chirp cannot pose as a
+// highlight; the handler escapes the snippet before turning them into markup.
+const (
+	HighlightStart = "\uE000"
+	HighlightStop  = "\uE001"
+)
+
+var _ Store = (*database.Queries)(nil)
+var _ Store = (*Memory)(nil)
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/IArtMediums/chirp_project/internal/auth"
+	"github.com/IArtMediums/chirp_project/internal/config"
+)
+
+// loadJWTKeys builds the access token key set. JWT_KEYS_DIR selects
+// asymmetric keys (see auth.LoadKeySet) with JWT_SIGNING_KEY_ID naming the one
+// to sign with; without it tokens fall back to HS256 with SECRET. The config
+// has already checked that one of them is set.
+func loadJWTKeys(settings *config.Config) (*auth.KeySet, error) {
+	if settings.JWTKeysDir != "" {
+		return auth.LoadKeySet(settings.JWTKeysDir, settings.JWTSigningKeyID)
+	}
+	return auth.NewHMACKeySet(settings.Secret), nil
+}
+
+// HandlerJWKS publishes the public keys that access tokens may be signed
+// with, so other services can verify them without a shared secret.
+func HandlerJWKS(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	data, err := json.Marshal(cfg.jwtKeys.JWKS())
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(200)
+	w.Write(data)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/auth"
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	throttleAccount = "account"
+	throttleIP = "ip"
+)
+
+// loginLockedUntil reports whether logins for email or from ip are locked,
+// and until when.
+func loginLockedUntil(ctx context.Context, cfg *apiConfig, email, ip string) (time.Time, bool, error) {
+	params := database.GetLoginLockParams{
+		Email: email,
+		IP: ip,
+	}
+	until, err := cfg.dbQueries.GetLoginLock(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return until.Time, until.Valid, nil
+}
+
+// recordLoginFailure counts a failed login against both the email and the
+// client IP, locking either once its policy says so. It runs to completion
+// even if the client hangs up, or hanging up would dodge the count.
+func recordLoginFailure(ctx context.Context, cfg *apiConfig, email, ip string) error {
+	ctx, cancel := detachedContext(ctx)
+	defer cancel()
+	cfg.metrics.LoginFailures.Inc()
+	throttles := []struct {
+		scope	string
+		subject	string
+		policy	auth.LockoutPolicy
+	}{
+		{throttleAccount, email, auth.AccountLockout},
+		{throttleIP, ip, auth.IPLockout},
+	}
+	for _, t := range throttles {
+		params := database.RecordLoginFailureParams{
+			Scope: t.scope,
+			Subject: t.subject,
+			WindowSeconds: int32(t.policy.Window / time.Second),
+		}
+		failures, err := cfg.dbQueries.RecordLoginFailure(ctx, params)
+		if err != nil {
+			return err
+		}
+		delay := t.policy.Delay(int(failures))
+		if delay == 0 {
+			continue
+		}
+		lock := database.LockLoginParams{
+			LockSeconds: int32(delay / time.Second),
+			Scope: t.scope,
+			Subject: t.subject,
+		}
+		if err := cfg.dbQueries.LockLogin(ctx, lock); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clearAccountLock(ctx context.Context, cfg *apiConfig, email string) error {
+	params := database.ClearLoginFailuresParams{
+		Scope: throttleAccount,
+		Subject: email,
+	}
+	return cfg.dbQueries.ClearLoginFailures(ctx, params)
+}
+
+// respondWithLoginLocked answers a locked login with the same 401 status as
+// a wrong password, so that logins fail uniformly; Retry-After says when to
+// try again.
+func respondWithLoginLocked(w http.ResponseWriter, until time.Time) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(time.Until(until)), 1)))
+	respondWithError(w, 401, codeLoginLocked, "too many failed login attempts, try again later", nil)
+}
+
+// HandlerAdminListLoginLocks lists the accounts and IPs that are currently
+// locked out of logging in. Locks are short-lived, so the list is not paged.
+func HandlerAdminListLoginLocks(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type lock struct {
+		Scope			string		`json:"scope"`
+		Subject			string		`json:"subject"`
+		UserID			*uuid.UUID	`json:"user_id"`
+		Failures		int32		`json:"failures"`
+		LastFailureAt	time.Time	`json:"last_failure_at"`
+		LockedUntil		time.Time	`json:"locked_until"`
+	}
+	type response struct {
+		Locks	[]lock	`json:"locks"`
+	}
+	locks, err := cfg.dbQueries.ListLoginLocks(r.Context())
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	res := response{Locks: []lock{}}
+	for _, l := range locks {
+		item := lock{
+			Scope: l.Scope,
+			Subject: l.Subject,
+			Failures: l.Failures,
+			LastFailureAt: l.LastFailureAt,
+			LockedUntil: l.LockedUntil.Time,
+		}
+		if l.UserID.Valid {
+			item.UserID = &l.UserID.UUID
+		}
+		res.Locks = append(res.Locks, item)
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// HandlerAdminUnlockUser clears a user's failed logins. Locks on the IPs
+// they logged in from are left to expire.
+func HandlerAdminUnlockUser(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	user_id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 404, codeUserNotFound, "user not found", err)
+		return
+	}
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByID(ctx, user_id)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	if err := recordAudit(ctx, r, cfg, "user.unlock", "user", user.ID.String(), nil); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if err := clearAccountLock(ctx, cfg, user.Email); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	respondWithAdminUser(w, user)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/logging"
+	"github.com/google/uuid"
+)
+
+// unmatchedRoute stands for requests no route matched, so that scanners
+// probing random paths add one metric series and log value rather than one
+// per path.
+const unmatchedRoute = "unmatched"
+
+func routePattern(mux *http.ServeMux, r *http.Request) string {
+	_, route := mux.Handler(r)
+	if route == "" {
+		return unmatchedRoute
+	}
+	return route
+}
+
+// statusRecorder remembers the status code a handler wrote, and the error
+// respondWithError was given, if any.
+type statusRecorder struct {
+	http.ResponseWriter
+	status	int
+	err		error
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Status is what the client got; a handler that wrote nothing sent a 200.
+func (s *statusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+// recordResponseError hands err to the recorders wrapping w, so that it is
+// logged with the rest of the request. It reports false if w is not wrapped
+// by any.
+func recordResponseError(w http.ResponseWriter, err error) bool {
+	recorded := false
+	for w != nil {
+		if rec, ok := w.(*statusRecorder); ok {
+			rec.err = err
+			recorded = true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	return recorded
+}
+
+// requestUser is filled in once a request has been authenticated, for the
+// request log line.
+type requestUser struct {
+	id	uuid.UUID
+}
+
+type requestUserKey struct{}
+
+// withRequestUser tags everything logged for the rest of the request with
+// the user's ID.
+func withRequestUser(ctx context.Context, userID uuid.UUID) context.Context {
+	if u, ok := ctx.Value(requestUserKey{}).(*requestUser); ok {
+		u.id = userID
+	}
+	return logging.WithLogger(ctx, logging.FromContext(ctx).With("user_id", userID))
+}
+
+// middlewareRequestLog gives every request an ID, taken from the
+// X-Request-ID header when the client or a proxy sent a usable one, echoes
+// it back, and puts a logger tagged with it in the request's context. Once
+// the request is served it logs one line for it; server errors are logged
+// at error level.
+func (a *apiConfig) middlewareRequestLog(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get("X-Request-ID")
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		logger := a.logger.With("request_id", id)
+		user := &requestUser{}
+		ctx := logging.WithLogger(r.Context(), logger)
+		ctx = context.WithValue(ctx, requestUserKey{}, user)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		status := rec.Status()
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", routePattern(mux, r)),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", logging.DurationMillis(time.Since(start))),
+			slog.String("ip", clientIP(r)),
+		}
+		if user.id != uuid.Nil {
+			attrs = append(attrs, slog.String("user_id", user.id.String()))
+		}
+		if rec.err != nil {
+			attrs = append(attrs, slog.String("error", rec.err.Error()))
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
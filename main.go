@@ -1,77 +1,200 @@
 package main
 import (
 	_ "github.com/lib/pq"
-	"strings"
 	"time"
-	"sort"
 	"github.com/google/uuid"
 	"context"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os/signal"
+	"syscall"
 	"fmt"
 	"io"
 	"os"
-	"sync/atomic"
 	"encoding/json"
+	"errors"
+	"crypto/subtle"
 	"database/sql"
 	"github.com/IArtMediums/chirp_project/internal/database"
-	"github.com/joho/godotenv"
+	"flag"
+	"strconv"
 	"github.com/IArtMediums/chirp_project/internal/auth"
+	"github.com/IArtMediums/chirp_project/internal/config"
+	"github.com/IArtMediums/chirp_project/internal/logging"
+	"github.com/IArtMediums/chirp_project/internal/mail"
+	"github.com/IArtMediums/chirp_project/internal/metrics"
+	"github.com/IArtMediums/chirp_project/internal/moderation"
+	"github.com/IArtMediums/chirp_project/internal/ratelimit"
+	"github.com/IArtMediums/chirp_project/internal/storage"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	dbQueries *database.Queries
+	dbQueries storage.Store
+	moderation *moderation.Filter
 	platform string
-	secret string
+	jwtKeys *auth.KeySet
 	polkaKey string
+	adminKey string
+	mailer mail.Mailer
+	metrics *metrics.Metrics
+	logger *slog.Logger
+	rateLimiter ratelimit.Store
+	rateLimits map[string]ratelimit.Policy
+	requestTimeout time.Duration
+	routeTimeouts map[string]time.Duration
 }
 
-var port string = "8080"
-var filePathRoot string = "/app/"
+// filePathRoot is the URL prefix the static files are served under.
+const filePathRoot = "/app/"
 
 func main() {
-	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	os.Exit(run())
+}
+
+// run starts the server and returns the exit code: 2 for bad configuration,
+// 1 if the server cannot start or stops with an error.
+func run() int {
+	settings, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
 	if err != nil {
-		fmt.Printf("%v\n", err)
-		return
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if settings.PrintConfig {
+		settings.Print(os.Stdout)
+		return 0
+	}
+	logger, err := logging.New(os.Stderr, settings.LogFormat, settings.LogLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	slog.SetDefault(logger)
+	logger.Info("starting", "config", settings)
+	db, err := sql.Open("postgres", settings.DBURL)
+	if err != nil {
+		logger.Error("open database", "error", err)
+		return 1
+	}
+	defer db.Close()
+	applyDBPool(db, settings)
+	if err := migrateOnStartup(context.Background(), db, settings, logger); err != nil {
+		logger.Error("check database schema", "error", err)
+		return 1
 	}
 	mux := http.NewServeMux()
-	config := &apiConfig{
-		fileserverHits: atomic.Int32{}, 
-		dbQueries: database.New(db), 
-		platform: os.Getenv("PLATFORM"), 
-		secret: os.Getenv("SECRET"),
-		polkaKey: os.Getenv("POLKA_KEY"),
+	m := metrics.New()
+	cfg := &apiConfig{
+		dbQueries: database.New(database.Instrument(db, m.ObserveQuery, logging.LogQuery)), 
+		metrics: m,
+		logger: logger,
+		platform: settings.Platform, 
+		polkaKey: settings.PolkaKey,
+		adminKey: settings.AdminKey,
+		rateLimiter: ratelimit.NewMemory(),
+		rateLimits: withRateLimitDefaults(settings.RateLimits),
+		requestTimeout: settings.RequestTimeout,
+		routeTimeouts: withRouteTimeoutDefaults(settings.RouteTimeouts),
+	}
+	cfg.mailer = mail.LogMailer{}
+	if settings.MailDir != "" {
+		cfg.mailer = mail.NewDirMailer(settings.MailDir, settings.MailFrom)
+	}
+	cfg.jwtKeys, err = loadJWTKeys(settings)
+	if err != nil {
+		logger.Error("load JWT keys", "error", err)
+		return 1
 	}
-	mux.Handle(filePathRoot, config.middlewareMetricsInc(GetFileServerHandler()))
-	registerHandlerFunctions(mux, config)
-	server := http.Server{}
-	server.Handler = mux
-	server.Addr = ":" + port
-	
-	if err := server.ListenAndServe(); err != nil {
-		fmt.Printf("%v\n", err)
-		return
+	var source moderation.WordSource = storeWordSource{cfg.dbQueries}
+	if settings.ModerationWordsFile != "" {
+		source = moderation.NewFileSource(settings.ModerationWordsFile)
 	}
+	cfg.moderation, err = moderation.NewFilter(context.Background(), source, settings.ModerationMode)
+	if err != nil {
+		logger.Error("load moderation words", "error", err)
+		return 1
+	}
+	mux.Handle(filePathRoot, GetFileServerHandler(settings.FileRoot))
+	registerHandlerFunctions(mux, cfg)
+	server := newServer(":" + strconv.Itoa(settings.Port), cfg.middlewareServer(mux), cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		logger.Error("listen", "error", err)
+		return 1
+	}
+	logger.Info("listening", "addr", server.Addr)
+	if err := serve(ctx, server, ln, settings.ShutdownTimeout, logger); err != nil {
+		logger.Error("serve", "error", err)
+		return 1
+	}
+	logger.Info("shut down")
+	return 0
 }
 
 func registerHandlerFunctions(mux *http.ServeMux, cfg *apiConfig) {
 	mux.HandleFunc("GET /api/healthz", HandlerHealthz)
-	mux.HandleFunc("GET /admin/metrics", cfg.displayMetrics())
-	mux.HandleFunc("POST /admin/reset", cfg.reset())
+	mux.HandleFunc("GET /metrics", cfg.middlewareAdminCfg(HandlerMetrics))
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.middlewareCfg(HandlerJWKS))
+	mux.HandleFunc("POST /admin/reset", cfg.middlewareAdminCfg(HandlerReset))
+	mux.HandleFunc("GET /admin/moderation/words", cfg.middlewareAdminCfg(HandlerListModerationWords))
+	mux.HandleFunc("POST /admin/moderation/words", cfg.middlewareAdminCfg(HandlerAddModerationWord))
+	mux.HandleFunc("DELETE /admin/moderation/words/{word}", cfg.middlewareAdminCfg(HandlerRemoveModerationWord))
+	mux.HandleFunc("GET /admin/moderation/flags", cfg.middlewareAdminCfg(HandlerListModerationFlags))
+	mux.HandleFunc("GET /admin/users", cfg.middlewareAdminCfg(HandlerAdminListUsers))
+	mux.HandleFunc("PUT /admin/users/{userID}/role", cfg.middlewareAdminCfg(HandlerSetUserRole))
+	mux.HandleFunc("PUT /admin/users/{userID}/chirpy-red", cfg.middlewareAdminCfg(HandlerAdminSetChirpyRed))
+	mux.HandleFunc("POST /admin/users/{userID}/disable", cfg.middlewareAdminCfg(HandlerAdminDisableUser))
+	mux.HandleFunc("POST /admin/users/{userID}/enable", cfg.middlewareAdminCfg(HandlerAdminEnableUser))
+	mux.HandleFunc("POST /admin/users/{userID}/unlock", cfg.middlewareAdminCfg(HandlerAdminUnlockUser))
+	mux.HandleFunc("POST /admin/users/{userID}/2fa/reset", cfg.middlewareAdminCfg(HandlerAdminResetTwoFactor))
+	mux.HandleFunc("POST /admin/users/{userID}/revoke-tokens", cfg.middlewareAdminCfg(HandlerAdminRevokeUserTokens))
+	mux.HandleFunc("DELETE /admin/chirps/{chirpID}", cfg.middlewareAdminCfg(HandlerAdminDeleteChirp))
+	mux.HandleFunc("GET /admin/lockouts", cfg.middlewareAdminCfg(HandlerAdminListLoginLocks))
+	mux.HandleFunc("GET /admin/audit", cfg.middlewareAdminCfg(HandlerAdminListAuditLog))
 	mux.HandleFunc("POST /api/users", cfg.middlewareCfg(HandlerCreateUser))
-	mux.HandleFunc("POST /api/chirps", cfg.middlewareAuthCfg(HandlerCreateChirp))
-	mux.HandleFunc("GET /api/chirps", cfg.middlewareCfg(HandlerGetAllChirps))
-	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.middlewareCfg(HandlerGetChirpByChirpID))
+	mux.HandleFunc("POST /api/chirps", cfg.middlewareAuthCfg(HandlerCreateChirp, auth.ScopeChirpsWrite))
+	mux.HandleFunc("GET /api/chirps", cfg.middlewareOptionalAuthCfg(HandlerGetAllChirps))
+	mux.HandleFunc("GET /api/chirps/search", cfg.middlewareCfg(HandlerSearchChirps))
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.middlewareOptionalAuthCfg(HandlerGetChirpByChirpID))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", cfg.middlewareCfg(HandlerGetChirpThread))
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", cfg.middlewareAuthCfg(HandlerEditChirp, auth.ScopeChirpsWrite))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", cfg.middlewareCfg(HandlerGetChirpRevisions))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", cfg.middlewareAuthCfg(HandlerLikeChirp, auth.ScopeChirpsWrite))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", cfg.middlewareAuthCfg(HandlerUnlikeChirp, auth.ScopeChirpsWrite))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", cfg.middlewareAuthCfg(HandlerRechirp, auth.ScopeChirpsWrite))
+	mux.HandleFunc("POST /api/verify-email", cfg.middlewareCfg(HandlerVerifyEmail))
+	mux.HandleFunc("POST /api/verify-email/resend", cfg.middlewareCfg(HandlerResendVerification))
+	mux.HandleFunc("POST /api/password-reset", cfg.middlewareCfg(HandlerRequestPasswordReset))
+	mux.HandleFunc("POST /api/password-reset/confirm", cfg.middlewareCfg(HandlerConfirmPasswordReset))
 	mux.HandleFunc("POST /api/login", cfg.middlewareCfg(HandlerLogin))
+	mux.HandleFunc("POST /api/login/2fa", cfg.middlewareCfg(HandlerLoginTwoFactor))
+	mux.HandleFunc("GET /api/users/2fa", cfg.middlewareAuthCfg(HandlerTwoFactorStatus))
+	mux.HandleFunc("POST /api/users/2fa/setup", cfg.middlewareAuthCfg(HandlerTwoFactorSetup, auth.ScopeUsersWrite))
+	mux.HandleFunc("POST /api/users/2fa/confirm", cfg.middlewareAuthCfg(HandlerTwoFactorConfirm, auth.ScopeUsersWrite))
+	mux.HandleFunc("POST /api/users/2fa/recovery-codes", cfg.middlewareAuthCfg(HandlerTwoFactorRecoveryCodes, auth.ScopeUsersWrite))
+	mux.HandleFunc("POST /api/users/2fa/disable", cfg.middlewareAuthCfg(HandlerTwoFactorDisable, auth.ScopeUsersWrite))
 	mux.HandleFunc("POST /api/refresh", cfg.middlewareCfg(HandlerRefreshToken))
 	mux.HandleFunc("POST /api/revoke", cfg.middlewareCfg(HandlerRevoke))
-	mux.HandleFunc("PUT /api/users", cfg.middlewareAuthCfg(HandlerUpdateLogin))
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.middlewareAuthCfg(HandlerDeleteChirp))
+	mux.HandleFunc("GET /api/sessions", cfg.middlewareAuthCfg(HandlerListSessions))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.middlewareAuthCfg(HandlerRevokeSession, auth.ScopeUsersWrite))
+	mux.HandleFunc("POST /api/logout-all", cfg.middlewareAuthCfg(HandlerLogoutAll, auth.ScopeUsersWrite))
+	mux.HandleFunc("PUT /api/users", cfg.middlewareAuthCfg(HandlerUpdateLogin, auth.ScopeUsersWrite))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.middlewareAuthCfg(HandlerDeleteChirp, auth.ScopeChirpsWrite))
 	mux.HandleFunc("POST /api/polka/webhooks", cfg.middlewareCfg(HandlerUpgradeUser))
+	mux.HandleFunc("POST /api/users/{userID}/follow", cfg.middlewareAuthCfg(HandlerFollowUser, auth.ScopeUsersWrite))
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", cfg.middlewareAuthCfg(HandlerUnfollowUser, auth.ScopeUsersWrite))
+	mux.HandleFunc("GET /api/users/{userID}/followers", cfg.middlewareCfg(HandlerGetFollowers))
+	mux.HandleFunc("GET /api/users/{userID}/following", cfg.middlewareCfg(HandlerGetFollowing))
+	mux.HandleFunc("GET /api/timeline", cfg.middlewareAuthCfg(HandlerGetTimeline))
 }
 
 func HandlerUpgradeUser(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
@@ -84,30 +207,28 @@ func HandlerUpgradeUser(w http.ResponseWriter, r *http.Request, cfg *apiConfig)
 	}
 	api_key, err := auth.GetAPIKey(r.Header)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(401)
+		respondWithError(w, 401, codeMissingAuth, err.Error(), err)
 		return
 	}
-	if api_key != cfg.polkaKey {
-		log.Printf("%v\n", err)
-		w.WriteHeader(401)
+	if cfg.polkaKey == "" || subtle.ConstantTimeCompare([]byte(api_key), []byte(cfg.polkaKey)) != 1 {
+		respondWithError(w, 401, codeInvalidAPIKey, "invalid API key", nil)
 		return
 	}
-	decoder := json.NewDecoder(r.Body)
 	req := request{}
-	if err := decoder.Decode(&req); err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 	if req.Event != "user.upgraded" {
 		w.WriteHeader(204)
 		return
 	}
-	ctx := context.Background()
+	ctx := r.Context()
+	if _, err := cfg.dbQueries.GetUserByID(ctx, req.Data.UserID); err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
 	if err := cfg.dbQueries.UpgradeUser(ctx, req.Data.UserID); err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(404)
+		respondWithInternalError(w, err)
 		return
 	}
 	w.WriteHeader(204)
@@ -117,30 +238,40 @@ func HandlerDeleteChirp(w http.ResponseWriter, r *http.Request, cfg *apiConfig,
 	idString := r.PathValue("chirpID")
 	chirp_id, err := uuid.Parse(idString)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(404)
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", err)
 		return
 	}
-	ctx := context.Background()
+	ctx := r.Context()
 	chirp, err := cfg.dbQueries.GetChirp(ctx, chirp_id)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(404)
+		respondWithLookupError(w, err, codeChirpNotFound, "chirp not found")
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", nil)
 		return
 	}
-	if chirp.UserID != id {
-		log.Printf("%v\n", err)
-		w.WriteHeader(403)
+	if chirp.UserID != id && !claimsFromRequest(r).HasScope(auth.ScopeChirpsModerate) {
+		respondWithError(w, 403, codeNotOwner, "chirp belongs to another user", nil)
 		return
 	}
-	if err := cfg.dbQueries.DeleteChirp(ctx, chirp_id); err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(404)
+	if err := removeChirp(ctx, cfg, chirp); err != nil {
+		respondWithInternalError(w, err)
 		return
 	}
 	w.WriteHeader(204)
 }
 
+// removeChirp deletes chirp, keeping a tombstone in place of chirps that
+// have replies so threads stay connected.
+func removeChirp(ctx context.Context, cfg *apiConfig, chirp database.Chirp) error {
+	delete_func := cfg.dbQueries.DeleteChirp
+	if chirp.ReplyCount > 0 {
+		delete_func = cfg.dbQueries.TombstoneChirp
+	}
+	return delete_func(ctx, chirp.ID)
+}
+
 func HandlerUpdateLogin(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
 	type request struct {
 		Password	string	`json:"password"`
@@ -152,19 +283,16 @@ func HandlerUpdateLogin(w http.ResponseWriter, r *http.Request, cfg *apiConfig,
 		CreatedAt	time.Time			`json:"created_at"`
 		UpdatedAt	time.Time			`json:"updated_at"`
 		IsChirpyRed	bool				`json:"is_chirpy_red"`
+		EmailVerified	bool			`json:"email_verified"`
 	}
-	decoder := json.NewDecoder(r.Body)
 	req := request{}
-	if err := decoder.Decode(&req); err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(401)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
-	ctx := context.Background()
+	ctx := r.Context()
 	hash, err := auth.HashPassword(req.Password)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
 	params := database.UpdateUserLoginParams{
@@ -173,22 +301,29 @@ func HandlerUpdateLogin(w http.ResponseWriter, r *http.Request, cfg *apiConfig,
 		ID: id,
 	}
 	user, err := cfg.dbQueries.UpdateUserLogin(ctx, params)
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, codeEmailTaken, "email is already registered", err)
+		return
+	}
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(401)
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
 		return
 	}
+	// A new address has to be verified before the next login.
+	if !user.EmailVerifiedAt.Valid {
+		sendVerificationEmail(ctx, cfg, user.ID, user.Email)
+	}
 	res := response{
 		ID: id,
 		Email: user.Email,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		IsChirpyRed: user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	}
 	data, err := json.Marshal(&res)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
 	w.WriteHeader(200)
@@ -199,14 +334,12 @@ func HandlerUpdateLogin(w http.ResponseWriter, r *http.Request, cfg *apiConfig,
 func HandlerRevoke(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
 	refToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(401)
+		respondWithError(w, 401, codeMissingAuth, err.Error(), err)
 		return
 	}
-	ctx := context.Background()
+	ctx := r.Context()
 	if err := cfg.dbQueries.RevokeToken(ctx, refToken); err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(401)
+		respondWithInternalError(w, err)
 		return
 	}
 	w.WriteHeader(204)
@@ -214,46 +347,166 @@ func HandlerRevoke(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
 
 func HandlerRefreshToken(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
 	type response struct {
-		Token string `json:"token"`
+		Token			string	`json:"token"`
+		RefreshToken	string	`json:"refresh_token"`
 	}
 	refToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(401)
+		respondWithError(w, 401, codeMissingAuth, err.Error(), err)
+		return
+	}
+	ctx := r.Context()
+	stored, err := cfg.dbQueries.GetRefreshToken(ctx, refToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 401, codeInvalidRefreshToken, "refresh token is invalid, expired or revoked", err)
 		return
 	}
-	ctx := context.Background()
-	id, err := cfg.dbQueries.GetUserFromRefreshToken(ctx, refToken)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(401)
+		respondWithInternalError(w, err)
+		return
+	}
+	if stored.RotatedAt.Valid {
+		handleRefreshTokenReuse(w, r, cfg, stored)
+		return
+	}
+	if stored.RevokedAt.Valid || !stored.ExpiresAt.After(time.Now().UTC()) {
+		respondWithError(w, 401, codeInvalidRefreshToken, "refresh token is invalid, expired or revoked", nil)
+		return
+	}
+	params := database.RotateRefreshTokenParams{
+		OldToken: refToken,
+		NewToken: auth.MakeRefreshToken(),
+		UserAgent: r.UserAgent(),
+		IP: clientIP(r),
+	}
+	rotated, err := cfg.dbQueries.RotateRefreshToken(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Another request rotated or revoked the token after we read it.
+		// Treat a lost race as reuse: two clients holding one token is what
+		// a stolen token looks like.
+		handleRefreshTokenReuse(w, r, cfg, stored)
 		return
 	}
-	acToken, err := CreateAccessToken(id, cfg)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
+		return
+	}
+	// Read the role afresh so role changes apply from the next refresh.
+	user, err := cfg.dbQueries.GetUserByID(ctx, rotated.UserID)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if user.DisabledAt.Valid {
+		respondWithError(w, 403, codeAccountDisabled, "account is disabled", nil)
+		return
+	}
+	acToken, err := CreateAccessToken(user.ID, auth.Role(user.Role), cfg)
+	if err != nil {
+		respondWithInternalError(w, err)
 		return
 	}
 	res := response{
 		Token: acToken,
+		RefreshToken: rotated.Token,
 	}
 	data, err := json.Marshal(&res)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
-	w.WriteHeader(200)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
 	w.Write(data)
 }
 
+// handleRefreshTokenReuse responds to a refresh token that was already
+// rotated. Only the newest token of a family is ever valid, so an old one
+// coming back means the family has leaked; all of it is revoked and the user
+// has to log in again.
+func handleRefreshTokenReuse(w http.ResponseWriter, r *http.Request, cfg *apiConfig, token database.RefreshToken) {
+	logging.FromContext(r.Context()).Warn("refresh token reuse detected, revoking token family", "token_user_id", token.UserID, "family_id", token.FamilyID)
+	ctx, cancel := detachedContext(r.Context())
+	defer cancel()
+	if err := cfg.dbQueries.RevokeTokenFamily(ctx, token.FamilyID); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	respondWithError(w, 401, codeRefreshTokenReused, "refresh token was already used; all sessions from this login have been revoked", nil)
+}
+
 func HandlerLogin(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
 	type request struct {
 		Email				string			`json:"email"`
 		Password			string			`json:"password"`
 	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	ctx := r.Context()
+	ip := clientIP(r)
+	until, locked, err := loginLockedUntil(ctx, cfg, req.Email, ip)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if locked {
+		respondWithLoginLocked(w, until)
+		return
+	}
+	// Unknown emails get the same work and the same 401 as a wrong password,
+	// so neither the status nor the timing says whether an account exists.
+	user, err := cfg.dbQueries.GetUserByEmail(ctx, req.Email)
+	match := false
+	if errors.Is(err, sql.ErrNoRows) {
+		auth.CheckDummyPassword(req.Password)
+	} else if err != nil {
+		respondWithInternalError(w, err)
+		return
+	} else {
+		match, err = auth.CheckPasswordHash(req.Password, user.HashedPassword)
+		if err != nil {
+			respondWithInternalError(w, err)
+			return
+		}
+	}
+	if !match {
+		if err := recordLoginFailure(ctx, cfg, req.Email, ip); err != nil {
+			respondWithInternalError(w, err)
+			return
+		}
+		respondWithError(w, 401, codeInvalidCredentials, "incorrect email or password", nil)
+		return
+	}
+	if user.DisabledAt.Valid {
+		respondWithError(w, 403, codeAccountDisabled, "account is disabled", nil)
+		return
+	}
+	if !user.EmailVerifiedAt.Valid {
+		respondWithError(w, 403, codeEmailNotVerified, "email address is not verified", nil)
+		return
+	}
+	// With two-factor authentication on, the password only earns a
+	// challenge, and failures keep counting until the second step succeeds.
+	enabled, err := twoFactorEnabled(ctx, cfg, user.ID)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if enabled {
+		respondWithLoginChallenge(w, r, cfg, user.ID)
+		return
+	}
+	if err := clearAccountLock(ctx, cfg, user.Email); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	respondWithLogin(w, r, cfg, user)
+}
+
+// respondWithLogin starts a new session for user and returns its tokens.
+func respondWithLogin(w http.ResponseWriter, r *http.Request, cfg *apiConfig, user database.User) {
 	type response struct {
 		ID				uuid.UUID	`json:"id"`
 		CreatedAt		time.Time	`json:"created_at"`
@@ -262,36 +515,16 @@ func HandlerLogin(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
 		Token			string		`json:"token"`
 		RefreshToken	string		`json:"refresh_token"`
 		IsChirpyRed		bool		`json:"is_chirpy_red"`
+		Role			auth.Role	`json:"role"`
 	}
-	decoder := json.NewDecoder(r.Body)
-	req := request{}
-	if err := decoder.Decode(&req); err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
-		return
-	}
-	ctx := context.Background()
-	user, err := cfg.dbQueries.GetUserByEmail(ctx, req.Email)
+	acToken, err := CreateAccessToken(user.ID, auth.Role(user.Role), cfg)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(404)
+		respondWithInternalError(w, err)
 		return
 	}
-	match, err := auth.CheckPasswordHash(req.Password, user.HashedPassword)
+	refToken, err := CreateRefreshToken(r, user.ID, uuid.New(), cfg)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
-		return
-	}
-	if !match {
-		w.WriteHeader(401)
-		return
-	}
-	acToken, err := CreateAccessToken(user.ID, cfg)
-	refToken, err := CreateRefreshToken(user.ID, cfg)
-	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
 	res := response{
@@ -302,11 +535,11 @@ func HandlerLogin(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
 		Token: acToken,
 		RefreshToken: refToken,
 		IsChirpyRed: user.IsChirpyRed,
+		Role: auth.Role(user.Role),
 	}
 	data, err := json.Marshal(&res)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
 	w.WriteHeader(200)
@@ -314,24 +547,30 @@ func HandlerLogin(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
 	w.Write(data)
 }
 
-func CreateAccessToken(id uuid.UUID, cfg *apiConfig) (string, error) {
+func CreateAccessToken(id uuid.UUID, role auth.Role, cfg *apiConfig) (string, error) {
 	duration, err := time.ParseDuration("1h")
 	if err != nil {
 		return "", err
 	}
-	acToken, err := auth.MakeJWT(id, cfg.secret, duration)
+	acToken, err := cfg.jwtKeys.MakeJWT(id, role, duration)
 	if err != nil {
 		return "", err
 	}
 	return acToken, nil
 }
 
-func CreateRefreshToken(id uuid.UUID, cfg *apiConfig) (string, error) {
+// CreateRefreshToken stores a new refresh token for id. Logging in starts a
+// new family; refreshing rotates within one instead. The client's user agent
+// and address are taken from r so the session can be listed later.
+func CreateRefreshToken(r *http.Request, id uuid.UUID, familyID uuid.UUID, cfg *apiConfig) (string, error) {
 	refToken := auth.MakeRefreshToken()
-	ctx := context.Background()
+	ctx := r.Context()
 	params := database.CreateTokenParams{
 		Token: refToken,
 		UserID: id,
+		FamilyID: familyID,
+		UserAgent: r.UserAgent(),
+		IP: clientIP(r),
 	}
 	_, err := cfg.dbQueries.CreateToken(ctx, params)
 	if err != nil {
@@ -344,39 +583,65 @@ func RefreshToken(refToken string, cfg *apiConfig) (uuid.UUID, error) {
 	return uuid.Nil, nil
 }
 
-func HandlerGetChirpByChirpID(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
-	type chirp struct {
-		ID			uuid.UUID	`json:"id"`
-		CreatedAt	time.Time	`json:"created_at"`
-		UpdatedAt	time.Time	`json:"updated_at"`
-		Body		string		`json:"body"`
-		UserID		uuid.UUID	`json:"user_id"`
+type chirpResponse struct {
+	ID			uuid.UUID	`json:"id"`
+	CreatedAt	time.Time	`json:"created_at"`
+	UpdatedAt	time.Time	`json:"updated_at"`
+	Body		string		`json:"body"`
+	UserID		uuid.UUID	`json:"user_id"`
+	ReplyTo		*uuid.UUID	`json:"reply_to"`
+	ReplyCount	int32		`json:"reply_count"`
+	LikeCount	int32		`json:"like_count"`
+	RechirpCount	int32	`json:"rechirp_count"`
+	LikedByMe	*bool		`json:"liked_by_me,omitempty"`
+	Edited		bool		`json:"edited"`
+	Deleted		bool		`json:"deleted,omitempty"`
+}
+
+func newChirpResponse(c database.Chirp) chirpResponse {
+	res := chirpResponse{
+		ID: c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body: c.Body,
+		UserID: c.UserID,
+		ReplyCount: c.ReplyCount,
+		LikeCount: c.LikeCount,
+		RechirpCount: c.RechirpCount,
+		Edited: c.EditedAt.Valid,
+		Deleted: c.DeletedAt.Valid,
 	}
+	if c.ReplyTo.Valid {
+		res.ReplyTo = &c.ReplyTo.UUID
+	}
+	return res
+}
+
+func HandlerGetChirpByChirpID(w http.ResponseWriter, r *http.Request, cfg *apiConfig, viewer uuid.UUID) {
 	idString := r.PathValue("chirpID")
 	id, err := uuid.Parse(idString)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(404)
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", err)
 		return
 	}
-	ctx := context.Background()
+	ctx := r.Context()
 	c, err := cfg.dbQueries.GetChirp(ctx, id)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(404)
+		respondWithLookupError(w, err, codeChirpNotFound, "chirp not found")
 		return
 	}
-	res := chirp{
-		ID: c.ID,
-		CreatedAt: c.CreatedAt,
-		UpdatedAt: c.UpdatedAt,
-		Body: c.Body,
-		UserID: c.UserID,
+	if c.DeletedAt.Valid {
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", nil)
+		return
 	}
-	data, err := json.Marshal(&res)
+	res := []chirpResponse{newChirpResponse(c)}
+	if err := markLikedByMe(ctx, cfg, viewer, res); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	data, err := json.Marshal(&res[0])
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
 	w.WriteHeader(200)
@@ -384,56 +649,57 @@ func HandlerGetChirpByChirpID(w http.ResponseWriter, r *http.Request, cfg *apiCo
 	w.Write(data)
 }
 
-func HandlerGetAllChirps(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
-	type chirp struct {
-		ID			uuid.UUID	`json:"id"`
-		CreatedAt	time.Time	`json:"created_at"`
-		UpdatedAt	time.Time	`json:"updated_at"`
-		Body		string		`json:"body"`
-		UserID		uuid.UUID	`json:"user_id"`
+func HandlerGetAllChirps(w http.ResponseWriter, r *http.Request, cfg *apiConfig, viewer uuid.UUID) {
+	type response struct {
+		Chirps		[]chirpResponse	`json:"chirps"`
+		NextCursor	string			`json:"next_cursor,omitempty"`
+	}
+	page, err := parsePageParams(r.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, codeInvalidQuery, err.Error(), err)
+		return
+	}
+	params := database.ListChirpsAscParams{
+		Limit: int32(page.Limit + 1),
 	}
 	author_id := r.URL.Query().Get("author_id")
-	var get_func func(context.Context) ([]database.Chirp, error)
 	if author_id != "" {
-		get_func = func(c context.Context) ([]database.Chirp, error) {
-			parsed, err := uuid.Parse(author_id)
-			if err != nil {
-				return cfg.dbQueries.GetChirps(c)
-			}
-			return cfg.dbQueries.GetChirpsByAuthor(c, parsed)
+		if parsed, err := uuid.Parse(author_id); err == nil {
+			params.AuthorID = uuid.NullUUID{UUID: parsed, Valid: true}
 		}
+	}
+	params.CursorCreatedAt, params.CursorID = keysetArgs(page.Cursor)
+	ctx := r.Context()
+	var chirps []database.Chirp
+	if page.Desc {
+		chirps, err = cfg.dbQueries.ListChirpsDesc(ctx, database.ListChirpsDescParams(params))
 	} else {
-		get_func = cfg.dbQueries.GetChirps
+		chirps, err = cfg.dbQueries.ListChirpsAsc(ctx, params)
 	}
-	res := []chirp{}
-	ctx := context.Background()
-	chirps, err := get_func(ctx)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
+	res := response{Chirps: []chirpResponse{}}
+	if len(chirps) > page.Limit {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		res.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
 	for _, c := range chirps {
-		res = append(res, chirp{
-			ID: c.ID,
-			CreatedAt: c.CreatedAt,
-			UpdatedAt: c.UpdatedAt,
-			Body: c.Body,
-			UserID: c.UserID,
-		})
-	}
-	sortQuery := r.URL.Query().Get("sort")
-	if sortQuery == "desc" {
-		sort.Slice(res, func(i, j int) bool {return res[i].CreatedAt.Compare(res[j].CreatedAt) == 1})
+		res.Chirps = append(res.Chirps, newChirpResponse(c))
+	}
+	if err := markLikedByMe(ctx, cfg, viewer, res.Chirps); err != nil {
+		respondWithInternalError(w, err)
+		return
 	}
 	data, err := json.Marshal(&res)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
-	w.WriteHeader(200)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
 	w.Write(data)
 }
 
@@ -448,19 +714,16 @@ func HandlerCreateUser(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
 		UpdatedAt	time.Time	`json:"updated_at"`
 		Email		string		`json:"email"`
 		IsChirpyRed	bool		`json:"is_chirpy_red"`
+		EmailVerified	bool	`json:"email_verified"`
 	}
-	decoder := json.NewDecoder(r.Body)
 	req := request{}
-	if err := decoder.Decode(&req); err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
-	ctx := context.Background()
+	ctx := r.Context()
 	hash, err := auth.HashPassword(req.Password)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
 	params := database.CreateUserParams{
@@ -468,11 +731,15 @@ func HandlerCreateUser(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
 		HashedPassword: hash,
 	}
 	user, err := cfg.dbQueries.CreateUser(ctx, params)
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, codeEmailTaken, "email is already registered", err)
+		return
+	}
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
+	sendVerificationEmail(ctx, cfg, user.ID, user.Email)
 	res := response{
 		ID: user.ID,
 		CreatedAt: user.CreatedAt,
@@ -483,8 +750,7 @@ func HandlerCreateUser(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
 	w.WriteHeader(201)
 	data, err := json.Marshal(&res)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -495,48 +761,50 @@ func HandlerCreateChirp(w http.ResponseWriter, r *http.Request, cfg *apiConfig,
 	type request struct {
 		Body	string		`json:"body"`
 		UserID	uuid.UUID	`json:"user_id"`
+		ReplyTo	*uuid.UUID	`json:"reply_to"`
 	}
-	type response struct {
-		ID			uuid.UUID	`json:"id"`
-		CreatedAt	time.Time	`json:"created_at"`
-		UpdatedAt	time.Time	`json:"updated_at"`
-		Body		string		`json:"body"`
-		UserID		uuid.UUID	`json:"user_id"`
-	}
-	decoder := json.NewDecoder(r.Body)
 	req := request{}
-	if err := decoder.Decode(&req); err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 	if !isChirpValid(req.Body) {
-		w.WriteHeader(400)
+		respondWithError(w, 400, codeChirpTooLong, "chirp is longer than 140 characters", nil)
 		return
 	}
-	findAndReplaceProfane(&req.Body)
-	ctx := context.Background()
+	moderated := cfg.moderation.Check(req.Body)
+	if moderated.Matched() && cfg.moderation.Mode() == moderation.ModeReject {
+		respondWithError(w, 400, codeChirpRejected, "chirp contains words that are not allowed", fmt.Errorf("chirp rejected by moderation: %v", moderated.Matches))
+		return
+	}
+	req.Body = moderated.Text
+	ctx := r.Context()
 	params := database.CreateChirpParams{
 		Body: req.Body,
 		UserID: id,
 	}
+	if req.ReplyTo != nil {
+		parent, err := cfg.dbQueries.GetChirp(ctx, *req.ReplyTo)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			respondWithInternalError(w, err)
+			return
+		}
+		if err != nil || parent.DeletedAt.Valid {
+			respondWithError(w, 400, codeInvalidReplyTo, "reply_to must be an existing chirp", fmt.Errorf("reply_to %v: %v", *req.ReplyTo, err))
+			return
+		}
+		params.ReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
 	chirp, err := cfg.dbQueries.CreateChirp(ctx, params)
 	if err != nil {
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
-	res := response{
-		ID: chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body: chirp.Body,
-		UserID: chirp.UserID,
-	}
+	cfg.metrics.ChirpsCreated.Inc()
+	flagChirp(ctx, cfg, chirp.ID, moderated)
+	res := newChirpResponse(chirp)
 	data, err := json.Marshal(&res)
 	if err != nil{
-		log.Printf("%v\n", err)
-		w.WriteHeader(500)
+		respondWithInternalError(w, err)
 		return
 	}
 	w.WriteHeader(201)
@@ -551,103 +819,170 @@ func isChirpValid(chirp string) bool {
 	return true
 }
 
-func findAndReplaceProfane(text *string) {
-	profane := map[string]struct{}{
-		"kerfuffle": {},
-		"sharbert": {},
-		"fornax": {},
-	}
-	replace := "****"
-	split := strings.Split(*text, " ")
-	result := []string{}
-	for _, word := range split {
-		formatedWord := strings.ToLower(word)
-		if containsString(profane, formatedWord) {
-			result = append(result, replace)
-			continue
-		}
-		result = append(result, word)
-	}
-	*text = strings.Join(result, " ")
+func HandlerHealthz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "OK")
 }
 
-func containsString(mapping map[string]struct{}, value string) bool {
-	_, ok := mapping[value]
-	return ok
+func GetFileServerHandler(dir string) http.Handler {
+	return http.StripPrefix(filePathRoot, http.FileServer(http.Dir(dir)))
 }
 
-func HandlerHealthz(w http.ResponseWriter, req *http.Request) {
+func HandlerReset(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	if cfg.platform != "dev" {
+		respondWithError(w, 403, codeForbidden, "reset is only available in dev", nil)
+		return
+	}
+	ctx := r.Context()
+	// Recorded first like every admin action, and before the reset deletes
+	// the acting admin's user row.
+	if err := recordAudit(ctx, r, cfg, "reset", "system", "", nil); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if err := cfg.dbQueries.ResetUsers(ctx); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, "OK")
 }
 
-func GetFileServerHandler() http.Handler {
-	return http.StripPrefix(filePathRoot, http.FileServer(http.Dir(".")))
+// middlewareServer wraps the mux in the middlewares every request goes
+// through, whatever its route. Logging and metrics come first so that
+// rate-limited requests are logged and counted too.
+func (a *apiConfig) middlewareServer(mux *http.ServeMux) http.Handler {
+	var handler http.Handler = mux
+	handler = a.middlewareRateLimit(mux, handler)
+	handler = a.middlewareTimeout(mux, handler)
+	handler = a.middlewareMetrics(mux, handler)
+	return a.middlewareRequestLog(mux, handler)
 }
 
-func (a *apiConfig) reset() func (http.ResponseWriter, *http.Request) {
+func (a *apiConfig) middlewareCfg(handler func (http.ResponseWriter, *http.Request, *apiConfig)) func (http.ResponseWriter, *http.Request) {
 	return func (w http.ResponseWriter, req *http.Request) {
-		if a.platform != "dev" {
-			w.WriteHeader(403)
+		handler(w, req, a)
+	}
+}
+
+// middlewareAuthCfg requires a valid access token carrying every one of
+// scopes. The token's claims are available to the handler through
+// claimsFromRequest.
+func (a *apiConfig) middlewareAuthCfg(handler func (http.ResponseWriter, *http.Request, *apiConfig, uuid.UUID), scopes ...string) func (http.ResponseWriter, *http.Request) {
+	return func (w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, 401, codeMissingAuth, err.Error(), err)
+			return
+		}
+		claims, err := a.jwtKeys.ParseJWT(token)
+		if err != nil {
+			respondWithError(w, 401, codeInvalidToken, "access token is invalid or expired", err)
+			return
+		}
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				respondWithError(w, 403, codeInsufficientScope, "access token lacks scope " + scope, nil)
+				return
+			}
+		}
+		id, err := claims.UserID()
+		if err != nil {
+			respondWithError(w, 401, codeInvalidToken, "access token is invalid or expired", err)
 			return
 		}
-		ctx := context.Background()
-		if err := a.dbQueries.ResetUsers(ctx); err != nil {
-			log.Printf("%v\n", err)
-			w.WriteHeader(500)
+		if _, ok := a.checkTokenUser(w, r, id); !ok {
 			return
 		}
-		a.fileserverHits.Store(0)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		io.WriteString(w, "OK")
+		handler(w, withClaims(r, claims), a, id)
 	}
 }
 
-func (a *apiConfig) displayMetrics() func (http.ResponseWriter, *http.Request) {
-	return func (w http.ResponseWriter, req *http.Request) {
-		contents := fmt.Sprintf(`
-			<html>
-			  <body>
-				<h1>Welcome, Chirpy Admin</h1>
-				<p>Chirpy has been visited %d times!</p>
-			  </body>
-			</html>
-			`, a.fileserverHits.Load())
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		io.WriteString(w, contents)
+// checkTokenUser looks up the user an access token was issued to, since the
+// token outlives changes to the account: a user disabled since gets 403, and
+// one deleted since gets 401. It reports whether the request may go on and
+// returns the user for further checks.
+func (a *apiConfig) checkTokenUser(w http.ResponseWriter, r *http.Request, id uuid.UUID) (database.User, bool) {
+	user, err := a.dbQueries.GetUserByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 401, codeInvalidToken, "access token is invalid or expired", err)
+		return database.User{}, false
 	}
+	if err != nil {
+		respondWithInternalError(w, err)
+		return database.User{}, false
+	}
+	if user.DisabledAt.Valid {
+		respondWithError(w, 403, codeAccountDisabled, "account is disabled", nil)
+		return database.User{}, false
+	}
+	return user, true
 }
 
-func (a *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
-	return http.HandlerFunc(func (w http.ResponseWriter, req *http.Request) {
-		a.fileserverHits.Add(1)
-		next.ServeHTTP(w, req)
-	})
-}
-
-func (a *apiConfig) middlewareCfg(handler func (http.ResponseWriter, *http.Request, *apiConfig)) func (http.ResponseWriter, *http.Request) {
-	return func (w http.ResponseWriter, req *http.Request) {
-		handler(w, req, a)
+// middlewareOptionalAuthCfg is middlewareAuthCfg for endpoints that are public
+// but personalize their response for a logged-in user. Requests without an
+// Authorization header get uuid.Nil; a header with a bad token is still 401.
+func (a *apiConfig) middlewareOptionalAuthCfg(handler func (http.ResponseWriter, *http.Request, *apiConfig, uuid.UUID)) func (http.ResponseWriter, *http.Request) {
+	return func (w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			handler(w, r, a, uuid.Nil)
+			return
+		}
+		a.middlewareAuthCfg(handler)(w, r)
 	}
 }
 
-func (a *apiConfig) middlewareAuthCfg(handler func (http.ResponseWriter, *http.Request, *apiConfig, uuid.UUID)) func (http.ResponseWriter, *http.Request) {
+// middlewareAdminCfg guards the admin API. It accepts either the ADMIN_KEY as
+// "ApiKey <key>" or an access token with the admin scope whose user is still
+// an admin; who was let in is available to the handler through
+// adminActorFromRequest for the audit log. Without ADMIN_KEY configured only
+// access tokens work.
+func (a *apiConfig) middlewareAdminCfg(handler func (http.ResponseWriter, *http.Request, *apiConfig)) func (http.ResponseWriter, *http.Request) {
 	return func (w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
-		if err != nil {
-			log.Printf("%v\n", err)
-			w.WriteHeader(401)
+		if token, err := auth.GetBearerToken(r.Header); err == nil {
+			claims, err := a.jwtKeys.ParseJWT(token)
+			if err != nil {
+				respondWithError(w, 401, codeInvalidToken, "access token is invalid or expired", err)
+				return
+			}
+			if !claims.HasScope(auth.ScopeAdmin) {
+				respondWithError(w, 403, codeInsufficientScope, "access token lacks scope " + auth.ScopeAdmin, nil)
+				return
+			}
+			id, err := claims.UserID()
+			if err != nil {
+				respondWithError(w, 401, codeInvalidToken, "access token is invalid or expired", err)
+				return
+			}
+			user, ok := a.checkTokenUser(w, r, id)
+			if !ok {
+				return
+			}
+			// The scope is only as fresh as the token, so a demoted admin
+			// is refused before their token expires.
+			if !auth.Role(user.Role).HasScope(auth.ScopeAdmin) {
+				respondWithError(w, 403, codeInsufficientScope, "access token lacks scope " + auth.ScopeAdmin, nil)
+				return
+			}
+			actor := adminActor{Kind: actorUser, UserID: uuid.NullUUID{UUID: id, Valid: true}}
+			handler(w, withAdminActor(withClaims(r, claims), actor), a)
 			return
 		}
-		id, err := auth.ValidateJWT(token, a.secret)
+		key, err := auth.GetAPIKey(r.Header)
 		if err != nil {
-			log.Printf("%v\n", err)
-			w.WriteHeader(401)
+			respondWithError(w, 401, codeMissingAuth, err.Error(), err)
+			return
+		}
+		if a.adminKey == "" {
+			respondWithError(w, 403, codeForbidden, "admin API key is disabled", nil)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(a.adminKey)) != 1 {
+			respondWithError(w, 401, codeInvalidAPIKey, "invalid API key", nil)
 			return
 		}
-		handler(w, r, a, id)
+		handler(w, withAdminActor(r, adminActor{Kind: actorAPIKey}), a)
 	}
 }
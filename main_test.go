@@ -0,0 +1,1644 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/auth"
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/IArtMediums/chirp_project/internal/mail"
+	"github.com/IArtMediums/chirp_project/internal/metrics"
+	"github.com/IArtMediums/chirp_project/internal/moderation"
+	"github.com/IArtMediums/chirp_project/internal/ratelimit"
+	"github.com/IArtMediums/chirp_project/internal/storage"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+const testSecret = "test-secret"
+const testPolkaKey = "test-polka-key"
+const testAdminKey = "test-admin-key"
+
+// testServer is a running API backed by in-memory storage. Mail goes to
+// mailDir so tests can read the tokens the API sends.
+type testServer struct {
+	*httptest.Server
+	mailDir string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newModeratedTestServer(t, moderation.ModeMask)
+}
+
+func newModeratedTestServer(t *testing.T, mode moderation.Mode) *testServer {
+	t.Helper()
+	return newConfiguredTestServer(t, mode, nil)
+}
+
+// newConfiguredTestServer lets configure adjust the config before the server
+// starts.
+func newConfiguredTestServer(t *testing.T, mode moderation.Mode, configure func(cfg *apiConfig)) *testServer {
+	t.Helper()
+	store := storage.NewMemory()
+	mailDir := t.TempDir()
+	filter, err := moderation.NewFilter(context.Background(), storeWordSource{store}, mode)
+	if err != nil {
+		t.Fatalf("NewFilter returned error: %v", err)
+	}
+	cfg := &apiConfig{
+		dbQueries:  store,
+		moderation: filter,
+		platform:   "dev",
+		jwtKeys:    auth.NewHMACKeySet(testSecret),
+		polkaKey:   testPolkaKey,
+		adminKey:   testAdminKey,
+		mailer:     mail.NewDirMailer(mailDir, "chirpy@localhost"),
+		metrics:    metrics.New(),
+		logger:     slog.New(slog.DiscardHandler),
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	mux := http.NewServeMux()
+	registerHandlerFunctions(mux, cfg)
+	srv := httptest.NewServer(cfg.middlewareServer(mux))
+	t.Cleanup(srv.Close)
+	return &testServer{Server: srv, mailDir: mailDir}
+}
+
+var emailTokenPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// lastEmailToken returns the token from the most recent email sent to the
+// address.
+func lastEmailToken(t *testing.T, srv *testServer, email string) string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(srv.mailDir, "*.eml"))
+	if err != nil {
+		t.Fatalf("Glob returned error: %v", err)
+	}
+	for i := len(paths) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(paths[i])
+		if err != nil {
+			t.Fatalf("ReadFile returned error: %v", err)
+		}
+		if !strings.Contains(string(data), "\r\nTo: "+email+"\r\n") {
+			continue
+		}
+		token := emailTokenPattern.FindString(string(data))
+		if token == "" {
+			t.Fatalf("no token in email to %s:\n%s", email, data)
+		}
+		return token
+	}
+	t.Fatalf("no email sent to %s", email)
+	return ""
+}
+
+// doJSON sends body (if non-nil) as JSON and decodes the response into out
+// (if non-nil). It returns the response status code.
+func doJSON(t *testing.T, srv *testServer, method, path, authHeader string, body, out any) int {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatalf("NewRequest returned error: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s returned error: %v", method, path, err)
+	}
+	defer res.Body.Close()
+	if out != nil && res.StatusCode < 300 {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s %s response: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+type testError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// expectError sends a request that should fail and checks the status and
+// the code in the JSON error body.
+func expectError(t *testing.T, srv *testServer, method, path, authHeader string, body any, status int, code string) {
+	t.Helper()
+	var reader *bytes.Reader
+	if raw, ok := body.(string); ok {
+		reader = bytes.NewReader([]byte(raw))
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatalf("NewRequest returned error: %v", err)
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s returned error: %v", method, path, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != status {
+		t.Fatalf("%s %s: expected %d, got %d", method, path, status, res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("%s %s: expected JSON error, got Content-Type %q", method, path, ct)
+	}
+	out := testError{}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatalf("decode %s %s error body: %v", method, path, err)
+	}
+	if out.Error.Code != code || out.Error.Message == "" {
+		t.Fatalf("%s %s: expected code %q with a message, got %+v", method, path, code, out.Error)
+	}
+}
+
+type testUser struct {
+	ID           string `json:"id"`
+	Email        string `json:"email"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	IsChirpyRed  bool   `json:"is_chirpy_red"`
+	Role         string `json:"role"`
+}
+
+type testChirp struct {
+	ID           string  `json:"id"`
+	Body         string  `json:"body"`
+	UserID       string  `json:"user_id"`
+	ReplyTo      *string `json:"reply_to"`
+	ReplyCount   int     `json:"reply_count"`
+	LikeCount    int     `json:"like_count"`
+	RechirpCount int     `json:"rechirp_count"`
+	LikedByMe    *bool   `json:"liked_by_me"`
+	Edited       bool    `json:"edited"`
+	Deleted      bool    `json:"deleted"`
+}
+
+type testChirpPage struct {
+	Chirps     []testChirp `json:"chirps"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+// signup creates a user, verifies their email and logs them in.
+func signup(t *testing.T, srv *testServer, email string) testUser {
+	t.Helper()
+	creds := map[string]string{"email": email, "password": "hunter2"}
+	if code := doJSON(t, srv, "POST", "/api/users", "", creds, nil); code != 201 {
+		t.Fatalf("create user: expected 201, got %d", code)
+	}
+	verifyEmail(t, srv, email)
+	return login(t, srv, email)
+}
+
+func verifyEmail(t *testing.T, srv *testServer, email string) {
+	t.Helper()
+	req := map[string]string{"token": lastEmailToken(t, srv, email)}
+	if code := doJSON(t, srv, "POST", "/api/verify-email", "", req, nil); code != 204 {
+		t.Fatalf("verify email: expected 204, got %d", code)
+	}
+}
+
+func login(t *testing.T, srv *testServer, email string) testUser {
+	t.Helper()
+	creds := map[string]string{"email": email, "password": "hunter2"}
+	user := testUser{}
+	if code := doJSON(t, srv, "POST", "/api/login", "", creds, &user); code != 200 {
+		t.Fatalf("login: expected 200, got %d", code)
+	}
+	return user
+}
+
+func postChirp(t *testing.T, srv *testServer, user testUser, body string) testChirp {
+	t.Helper()
+	chirp := testChirp{}
+	code := doJSON(t, srv, "POST", "/api/chirps", "Bearer "+user.Token, map[string]string{"body": body}, &chirp)
+	if code != 201 {
+		t.Fatalf("create chirp: expected 201, got %d", code)
+	}
+	return chirp
+}
+
+func postReply(t *testing.T, srv *testServer, user testUser, parentID, body string) testChirp {
+	t.Helper()
+	chirp := testChirp{}
+	req := map[string]string{"body": body, "reply_to": parentID}
+	if code := doJSON(t, srv, "POST", "/api/chirps", "Bearer "+user.Token, req, &chirp); code != 201 {
+		t.Fatalf("create reply: expected 201, got %d", code)
+	}
+	return chirp
+}
+
+func TestLoginAndRefreshFlow(t *testing.T) {
+	srv := newTestServer(t)
+	user := signup(t, srv, "alice@example.com")
+	if user.Token == "" || user.RefreshToken == "" {
+		t.Fatalf("expected access and refresh tokens, got %+v", user)
+	}
+
+	wrong := map[string]string{"email": "alice@example.com", "password": "wrong"}
+	if code := doJSON(t, srv, "POST", "/api/login", "", wrong, nil); code != 401 {
+		t.Fatalf("login with wrong password: expected 401, got %d", code)
+	}
+
+	refreshed := refresh(t, srv, user.RefreshToken)
+	if refreshed.Token == "" {
+		t.Fatalf("expected a new access token")
+	}
+
+	if code := doJSON(t, srv, "POST", "/api/revoke", "Bearer "+refreshed.RefreshToken, nil, nil); code != 204 {
+		t.Fatalf("revoke: expected 204, got %d", code)
+	}
+	expectError(t, srv, "POST", "/api/refresh", "Bearer "+refreshed.RefreshToken, nil, 401, "invalid_refresh_token")
+}
+
+type testTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func refresh(t *testing.T, srv *testServer, refreshToken string) testTokens {
+	t.Helper()
+	out := testTokens{}
+	if code := doJSON(t, srv, "POST", "/api/refresh", "Bearer "+refreshToken, nil, &out); code != 200 {
+		t.Fatalf("refresh: expected 200, got %d", code)
+	}
+	return out
+}
+
+func TestRefreshTokenRotationAndReuse(t *testing.T) {
+	srv := newTestServer(t)
+	user := signup(t, srv, "alice@example.com")
+
+	first := refresh(t, srv, user.RefreshToken)
+	if first.RefreshToken == "" || first.RefreshToken == user.RefreshToken {
+		t.Fatalf("expected a new refresh token, got %q", first.RefreshToken)
+	}
+	second := refresh(t, srv, first.RefreshToken)
+
+	// A separate login is a separate family and must survive the reuse below.
+	other := login(t, srv, "alice@example.com")
+
+	expectError(t, srv, "POST", "/api/refresh", "Bearer "+user.RefreshToken, nil, 401, "refresh_token_reused")
+	expectError(t, srv, "POST", "/api/refresh", "Bearer "+second.RefreshToken, nil, 401, "invalid_refresh_token")
+	refresh(t, srv, other.RefreshToken)
+}
+
+func TestJWKSWithSharedSecret(t *testing.T) {
+	srv := newTestServer(t)
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if code := doJSON(t, srv, "GET", "/.well-known/jwks.json", "", nil, &set); code != 200 {
+		t.Fatalf("jwks: expected 200, got %d", code)
+	}
+	if set.Keys == nil || len(set.Keys) != 0 {
+		t.Fatalf("expected an empty key list for HS256, got %+v", set.Keys)
+	}
+}
+
+type testSessions struct {
+	Sessions []struct {
+		ID        string `json:"id"`
+		UserAgent string `json:"user_agent"`
+		IP        string `json:"ip"`
+	} `json:"sessions"`
+}
+
+func TestSessions(t *testing.T) {
+	srv := newTestServer(t)
+	user := signup(t, srv, "alice@example.com")
+	other := login(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+	// Rotation keeps the session; only a new login adds one.
+	rotated := refresh(t, srv, user.RefreshToken)
+
+	var list testSessions
+	if code := doJSON(t, srv, "GET", "/api/sessions", "Bearer "+user.Token, nil, &list); code != 200 {
+		t.Fatalf("list sessions: expected 200, got %d", code)
+	}
+	if len(list.Sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", list.Sessions)
+	}
+	if s := list.Sessions[0]; s.IP != "127.0.0.1" || !strings.HasPrefix(s.UserAgent, "Go-http-client") {
+		t.Fatalf("expected client details on session, got %+v", s)
+	}
+
+	// The most recently used session comes first; that is the rotated one.
+	session := list.Sessions[0].ID
+	expectError(t, srv, "DELETE", "/api/sessions/"+session, "Bearer "+bob.Token, nil, 404, "session_not_found")
+	expectError(t, srv, "DELETE", "/api/sessions/not-a-uuid", "Bearer "+user.Token, nil, 404, "session_not_found")
+	if code := doJSON(t, srv, "DELETE", "/api/sessions/"+session, "Bearer "+user.Token, nil, nil); code != 204 {
+		t.Fatalf("revoke session: expected 204, got %d", code)
+	}
+	expectError(t, srv, "DELETE", "/api/sessions/"+session, "Bearer "+user.Token, nil, 404, "session_not_found")
+	expectError(t, srv, "POST", "/api/refresh", "Bearer "+rotated.RefreshToken, nil, 401, "invalid_refresh_token")
+	refresh(t, srv, bob.RefreshToken)
+
+	if code := doJSON(t, srv, "POST", "/api/logout-all", "Bearer "+user.Token, nil, nil); code != 204 {
+		t.Fatalf("logout all: expected 204, got %d", code)
+	}
+	expectError(t, srv, "POST", "/api/refresh", "Bearer "+other.RefreshToken, nil, 401, "invalid_refresh_token")
+	list = testSessions{}
+	if code := doJSON(t, srv, "GET", "/api/sessions", "Bearer "+user.Token, nil, &list); code != 200 || len(list.Sessions) != 0 {
+		t.Fatalf("expected no sessions after logout-all, got %d %+v", code, list.Sessions)
+	}
+	expectError(t, srv, "GET", "/api/sessions", "", nil, 401, "missing_authorization")
+}
+
+func TestCreateChirpFiltersProfanity(t *testing.T) {
+	srv := newTestServer(t)
+	user := signup(t, srv, "alice@example.com")
+
+	chirp := postChirp(t, srv, user, "what a kerfuffle today")
+	if chirp.Body != "what a **** today" {
+		t.Fatalf("expected profanity to be masked, got %q", chirp.Body)
+	}
+	if chirp.UserID != user.ID {
+		t.Fatalf("expected user_id %s, got %s", user.ID, chirp.UserID)
+	}
+
+	long := string(bytes.Repeat([]byte("a"), 141))
+	code := doJSON(t, srv, "POST", "/api/chirps", "Bearer "+user.Token, map[string]string{"body": long}, nil)
+	if code != 400 {
+		t.Fatalf("long chirp: expected 400, got %d", code)
+	}
+
+	if code := doJSON(t, srv, "POST", "/api/chirps", "", map[string]string{"body": "hi"}, nil); code != 401 {
+		t.Fatalf("unauthenticated chirp: expected 401, got %d", code)
+	}
+}
+
+func TestModerationMasksPunctuationAndAdminEdits(t *testing.T) {
+	srv := newTestServer(t)
+	user := signup(t, srv, "alice@example.com")
+	admin := "ApiKey " + testAdminKey
+
+	if chirp := postChirp(t, srv, user, "Kerfuffle! That was fornax."); chirp.Body != "****! That was ****." {
+		t.Fatalf("expected punctuation-adjacent words masked, got %q", chirp.Body)
+	}
+
+	if code := doJSON(t, srv, "GET", "/admin/moderation/words", "", nil, nil); code != 401 {
+		t.Fatalf("words without key: expected 401, got %d", code)
+	}
+	if code := doJSON(t, srv, "POST", "/admin/moderation/words", admin, map[string]string{"word": "two words"}, nil); code != 400 {
+		t.Fatalf("invalid word: expected 400, got %d", code)
+	}
+	if code := doJSON(t, srv, "POST", "/admin/moderation/words", admin, map[string]string{"word": "Bogus"}, nil); code != 201 {
+		t.Fatalf("add word: expected 201, got %d", code)
+	}
+	if code := doJSON(t, srv, "DELETE", "/admin/moderation/words/kerfuffle", admin, nil, nil); code != 204 {
+		t.Fatalf("remove word: expected 204, got %d", code)
+	}
+
+	var list struct {
+		Mode  string   `json:"mode"`
+		Words []string `json:"words"`
+	}
+	if code := doJSON(t, srv, "GET", "/admin/moderation/words", admin, nil, &list); code != 200 {
+		t.Fatalf("list words: expected 200, got %d", code)
+	}
+	if list.Mode != "mask" || strings.Join(list.Words, ",") != "bogus,fornax,sharbert" {
+		t.Fatalf("unexpected word list: %+v", list)
+	}
+
+	if chirp := postChirp(t, srv, user, "bogus kerfuffle"); chirp.Body != "**** kerfuffle" {
+		t.Fatalf("expected edits to apply without restart, got %q", chirp.Body)
+	}
+}
+
+func TestModerationRejectAndFlagModes(t *testing.T) {
+	srv := newModeratedTestServer(t, moderation.ModeReject)
+	user := signup(t, srv, "alice@example.com")
+	code := doJSON(t, srv, "POST", "/api/chirps", "Bearer "+user.Token, map[string]string{"body": "Sharbert?"}, nil)
+	if code != 400 {
+		t.Fatalf("reject mode: expected 400, got %d", code)
+	}
+
+	srv = newModeratedTestServer(t, moderation.ModeFlag)
+	user = signup(t, srv, "alice@example.com")
+	chirp := postChirp(t, srv, user, "Sharbert? sharbert!")
+	if chirp.Body != "Sharbert? sharbert!" {
+		t.Fatalf("flag mode: expected body unchanged, got %q", chirp.Body)
+	}
+	postChirp(t, srv, user, "all clean")
+
+	var flags struct {
+		Flags []struct {
+			ChirpID string   `json:"chirp_id"`
+			Words   []string `json:"words"`
+		} `json:"flags"`
+	}
+	if code := doJSON(t, srv, "GET", "/admin/moderation/flags", "ApiKey "+testAdminKey, nil, &flags); code != 200 {
+		t.Fatalf("list flags: expected 200, got %d", code)
+	}
+	if len(flags.Flags) != 1 || flags.Flags[0].ChirpID != chirp.ID || strings.Join(flags.Flags[0].Words, ",") != "sharbert" {
+		t.Fatalf("unexpected flags: %+v", flags.Flags)
+	}
+}
+
+func TestListChirpsPagination(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+	for _, body := range []string{"one", "two", "three"} {
+		postChirp(t, srv, alice, body)
+	}
+	postChirp(t, srv, bob, "bob's chirp")
+
+	page := testChirpPage{}
+	if code := doJSON(t, srv, "GET", "/api/chirps?limit=2", "", nil, &page); code != 200 {
+		t.Fatalf("list chirps: expected 200, got %d", code)
+	}
+	if len(page.Chirps) != 2 || page.NextCursor == "" {
+		t.Fatalf("expected 2 chirps and a cursor, got %+v", page)
+	}
+
+	seen := len(page.Chirps)
+	for page.NextCursor != "" {
+		next := testChirpPage{}
+		if code := doJSON(t, srv, "GET", "/api/chirps?limit=2&cursor="+page.NextCursor, "", nil, &next); code != 200 {
+			t.Fatalf("list next page: expected 200, got %d", code)
+		}
+		seen += len(next.Chirps)
+		page = next
+	}
+	if seen != 4 {
+		t.Fatalf("expected to page through 4 chirps, saw %d", seen)
+	}
+
+	byAuthor := testChirpPage{}
+	if code := doJSON(t, srv, "GET", "/api/chirps?sort=desc&author_id="+alice.ID, "", nil, &byAuthor); code != 200 {
+		t.Fatalf("list by author: expected 200, got %d", code)
+	}
+	if len(byAuthor.Chirps) != 3 || byAuthor.Chirps[0].Body != "three" {
+		t.Fatalf("expected alice's chirps newest first, got %+v", byAuthor.Chirps)
+	}
+
+	if code := doJSON(t, srv, "GET", "/api/chirps?cursor=bogus", "", nil, nil); code != 400 {
+		t.Fatalf("bad cursor: expected 400, got %d", code)
+	}
+}
+
+func TestDeleteChirpOwnership(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+	chirp := postChirp(t, srv, alice, "mine")
+
+	if code := doJSON(t, srv, "DELETE", "/api/chirps/"+chirp.ID, "Bearer "+bob.Token, nil, nil); code != 403 {
+		t.Fatalf("delete by non-owner: expected 403, got %d", code)
+	}
+	if code := doJSON(t, srv, "DELETE", "/api/chirps/"+chirp.ID, "Bearer "+alice.Token, nil, nil); code != 204 {
+		t.Fatalf("delete by owner: expected 204, got %d", code)
+	}
+	if code := doJSON(t, srv, "GET", "/api/chirps/"+chirp.ID, "", nil, nil); code != 404 {
+		t.Fatalf("get deleted chirp: expected 404, got %d", code)
+	}
+}
+
+func TestRolesAndScopes(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	mod := signup(t, srv, "mod@example.com")
+	if mod.Role != "user" {
+		t.Fatalf("expected new users to have role user, got %q", mod.Role)
+	}
+	chirp := postChirp(t, srv, alice, "hello")
+	admin := "ApiKey " + testAdminKey
+
+	expectError(t, srv, "PUT", "/admin/users/"+mod.ID+"/role", admin, map[string]string{"role": "root"}, 400, "invalid_role")
+	expectError(t, srv, "PUT", "/admin/users/"+alice.ID+"/role", "", map[string]string{"role": "admin"}, 401, "missing_authorization")
+	var updated testUser
+	if code := doJSON(t, srv, "PUT", "/admin/users/"+mod.ID+"/role", admin, map[string]string{"role": "moderator"}, &updated); code != 200 || updated.Role != "moderator" {
+		t.Fatalf("set role: expected 200 with moderator, got %d %+v", code, updated)
+	}
+
+	// The old token still carries user scopes until it is refreshed.
+	expectError(t, srv, "DELETE", "/api/chirps/"+chirp.ID, "Bearer "+mod.Token, nil, 403, "not_owner")
+	refreshed := refresh(t, srv, mod.RefreshToken)
+	if code := doJSON(t, srv, "DELETE", "/api/chirps/"+chirp.ID, "Bearer "+refreshed.Token, nil, nil); code != 204 {
+		t.Fatalf("moderator delete: expected 204, got %d", code)
+	}
+
+	// A token without chirps:write cannot post.
+	claims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			Subject:   alice.ID,
+		},
+		Role:  auth.RoleUser,
+		Scope: auth.ScopeUsersWrite,
+	}
+	limited, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("SignedString returned error: %v", err)
+	}
+	expectError(t, srv, "POST", "/api/chirps", "Bearer "+limited, map[string]string{"body": "hi"}, 403, "insufficient_scope")
+	if code := doJSON(t, srv, "GET", "/api/timeline", "Bearer "+limited, nil, nil); code != 200 {
+		t.Fatalf("timeline needs no scope: expected 200, got %d", code)
+	}
+}
+
+type testAuditLog struct {
+	Entries []struct {
+		Actor       string  `json:"actor"`
+		ActorUserID *string `json:"actor_user_id"`
+		Action      string  `json:"action"`
+		TargetID    string  `json:"target_id"`
+	} `json:"entries"`
+}
+
+func TestAdminAPI(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+	chirp := postChirp(t, srv, bob, "hello")
+	key := "ApiKey " + testAdminKey
+
+	expectError(t, srv, "GET", "/admin/lockouts", "", nil, 401, "missing_authorization")
+	expectError(t, srv, "GET", "/admin/users", "Bearer "+alice.Token, nil, 403, "insufficient_scope")
+	if code := doJSON(t, srv, "GET", "/admin/lockouts", key, nil, nil); code != 200 {
+		t.Fatalf("lockouts with key: expected 200, got %d", code)
+	}
+
+	// Promote alice with the key; from her next refresh she can use the API.
+	if code := doJSON(t, srv, "PUT", "/admin/users/"+alice.ID+"/role", key, map[string]string{"role": "admin"}, nil); code != 200 {
+		t.Fatalf("set role: expected 200, got %d", code)
+	}
+	admin := "Bearer " + refresh(t, srv, alice.RefreshToken).Token
+
+	var users struct {
+		Users []testUser `json:"users"`
+	}
+	if code := doJSON(t, srv, "GET", "/admin/users?q=BOB", admin, nil, &users); code != 200 {
+		t.Fatalf("list users: expected 200, got %d", code)
+	}
+	if len(users.Users) != 1 || users.Users[0].ID != bob.ID {
+		t.Fatalf("expected search to find bob only, got %+v", users.Users)
+	}
+
+	var red testUser
+	if code := doJSON(t, srv, "PUT", "/admin/users/"+bob.ID+"/chirpy-red", admin, map[string]bool{"is_chirpy_red": true}, &red); code != 200 || !red.IsChirpyRed {
+		t.Fatalf("set chirpy red: expected 200 with is_chirpy_red, got %d %+v", code, red)
+	}
+
+	if code := doJSON(t, srv, "POST", "/admin/users/"+bob.ID+"/disable", admin, nil, nil); code != 200 {
+		t.Fatalf("disable: expected 200, got %d", code)
+	}
+	expectError(t, srv, "POST", "/api/refresh", "Bearer "+bob.RefreshToken, nil, 401, "invalid_refresh_token")
+	creds := map[string]string{"email": "bob@example.com", "password": "hunter2"}
+	expectError(t, srv, "POST", "/api/login", "", creds, 403, "account_disabled")
+	// The access token bob already holds is refused too.
+	expectError(t, srv, "GET", "/api/timeline", "Bearer "+bob.Token, nil, 403, "account_disabled")
+	expectError(t, srv, "POST", "/api/chirps", "Bearer "+bob.Token, map[string]string{"body": "still here"}, 403, "account_disabled")
+	expectError(t, srv, "GET", "/api/chirps", "Bearer "+bob.Token, nil, 403, "account_disabled")
+	if code := doJSON(t, srv, "POST", "/admin/users/"+bob.ID+"/enable", admin, nil, nil); code != 200 {
+		t.Fatalf("enable: expected 200, got %d", code)
+	}
+	bob = login(t, srv, "bob@example.com")
+
+	if code := doJSON(t, srv, "POST", "/admin/users/"+bob.ID+"/revoke-tokens", admin, nil, nil); code != 204 {
+		t.Fatalf("revoke tokens: expected 204, got %d", code)
+	}
+	expectError(t, srv, "POST", "/api/refresh", "Bearer "+bob.RefreshToken, nil, 401, "invalid_refresh_token")
+	expectError(t, srv, "POST", "/admin/users/00000000-0000-0000-0000-000000000000/revoke-tokens", admin, nil, 404, "user_not_found")
+
+	if code := doJSON(t, srv, "DELETE", "/admin/chirps/"+chirp.ID, admin, nil, nil); code != 204 {
+		t.Fatalf("admin delete chirp: expected 204, got %d", code)
+	}
+	expectError(t, srv, "DELETE", "/admin/chirps/"+chirp.ID, admin, nil, 404, "chirp_not_found")
+
+	var audit testAuditLog
+	if code := doJSON(t, srv, "GET", "/admin/audit?limit=100", key, nil, &audit); code != 200 {
+		t.Fatalf("audit log: expected 200, got %d", code)
+	}
+	var actions []string
+	for _, e := range audit.Entries {
+		actions = append(actions, e.Action)
+	}
+	want := "chirp.delete,user.revoke_tokens,user.enable,user.disable,user.set_chirpy_red,user.set_role"
+	if got := strings.Join(actions, ","); got != want {
+		t.Fatalf("expected audit actions %s, got %s", want, got)
+	}
+	first, last := audit.Entries[0], audit.Entries[len(audit.Entries)-1]
+	if first.Actor != "user" || first.ActorUserID == nil || *first.ActorUserID != alice.ID || first.TargetID != chirp.ID {
+		t.Fatalf("unexpected audit entry for token actor: %+v", first)
+	}
+	if last.Actor != "api_key" || last.ActorUserID != nil || last.TargetID != alice.ID {
+		t.Fatalf("unexpected audit entry for key actor: %+v", last)
+	}
+
+	// Once demoted, alice's token still carries the admin scope but no
+	// longer opens the admin API.
+	if code := doJSON(t, srv, "PUT", "/admin/users/"+alice.ID+"/role", key, map[string]string{"role": "user"}, nil); code != 200 {
+		t.Fatalf("demote: expected 200, got %d", code)
+	}
+	expectError(t, srv, "GET", "/admin/users", admin, nil, 403, "insufficient_scope")
+}
+
+// auditFailingStore cannot write to the audit log.
+type auditFailingStore struct {
+	storage.Store
+}
+
+func (auditFailingStore) CreateAuditLogEntry(ctx context.Context, arg database.CreateAuditLogEntryParams) error {
+	return errors.New("audit log unavailable")
+}
+
+func TestAdminActionFailsWithoutAudit(t *testing.T) {
+	srv := newConfiguredTestServer(t, moderation.ModeMask, func(cfg *apiConfig) {
+		cfg.dbQueries = auditFailingStore{cfg.dbQueries}
+	})
+	alice := signup(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+	enableTwoFactor(t, srv, bob)
+	key := "ApiKey " + testAdminKey
+
+	expectError(t, srv, "POST", "/admin/users/"+alice.ID+"/disable", key, nil, 500, "internal_error")
+	expectError(t, srv, "PUT", "/admin/users/"+alice.ID+"/role", key, map[string]string{"role": "admin"}, 500, "internal_error")
+	expectError(t, srv, "POST", "/admin/moderation/words", key, map[string]string{"word": "darn"}, 500, "internal_error")
+	expectError(t, srv, "POST", "/admin/users/"+bob.ID+"/2fa/reset", key, nil, 500, "internal_error")
+	expectError(t, srv, "POST", "/admin/reset", key, nil, 500, "internal_error")
+	// Actions are audited first, so none of them ran.
+	alice = login(t, srv, "alice@example.com")
+	if code := doJSON(t, srv, "GET", "/admin/audit", "Bearer "+alice.Token, nil, nil); code != 403 {
+		t.Fatalf("admin API after failed role change: expected 403, got %d", code)
+	}
+	if chirp := postChirp(t, srv, alice, "darn it"); chirp.Body != "darn it" {
+		t.Fatalf("expected the word list unchanged, got %q", chirp.Body)
+	}
+	// bob still exists and still has two-factor authentication.
+	loginChallenge(t, srv, "bob@example.com")
+}
+
+func TestPolkaWebhookUpgradesUser(t *testing.T) {
+	srv := newTestServer(t)
+	user := signup(t, srv, "alice@example.com")
+	event := map[string]any{
+		"event": "user.upgraded",
+		"data":  map[string]string{"user_id": user.ID},
+	}
+
+	if code := doJSON(t, srv, "POST", "/api/polka/webhooks", "ApiKey wrong", event, nil); code != 401 {
+		t.Fatalf("webhook with wrong key: expected 401, got %d", code)
+	}
+	if code := doJSON(t, srv, "POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey, event, nil); code != 204 {
+		t.Fatalf("webhook: expected 204, got %d", code)
+	}
+
+	creds := map[string]string{"email": "alice@example.com", "password": "hunter2"}
+	upgraded := testUser{}
+	if code := doJSON(t, srv, "POST", "/api/login", "", creds, &upgraded); code != 200 {
+		t.Fatalf("login: expected 200, got %d", code)
+	}
+	if !upgraded.IsChirpyRed {
+		t.Fatalf("expected user to be chirpy red after webhook")
+	}
+}
+
+func TestSearchChirps(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+	postChirp(t, srv, alice, "Gophers love Go")
+	postChirp(t, srv, alice, "Go go go, said the gopher")
+	postChirp(t, srv, bob, "I prefer tea")
+	postChirp(t, srv, bob, "Go is fine I guess")
+
+	page := testChirpPage{}
+	if code := doJSON(t, srv, "GET", "/api/chirps/search?q=go&limit=2", "", nil, &page); code != 200 {
+		t.Fatalf("search: expected 200, got %d", code)
+	}
+	if len(page.Chirps) != 2 || page.NextCursor == "" {
+		t.Fatalf("expected 2 results and a cursor, got %+v", page)
+	}
+	if page.Chirps[0].Body != "Go go go, said the gopher" {
+		t.Fatalf("expected best match first, got %q", page.Chirps[0].Body)
+	}
+
+	next := testChirpPage{}
+	if code := doJSON(t, srv, "GET", "/api/chirps/search?q=go&limit=2&cursor="+page.NextCursor, "", nil, &next); code != 200 {
+		t.Fatalf("search next page: expected 200, got %d", code)
+	}
+	if len(next.Chirps) != 1 || next.NextCursor != "" {
+		t.Fatalf("expected 1 final result, got %+v", next)
+	}
+
+	byAuthor := testChirpPage{}
+	if code := doJSON(t, srv, "GET", "/api/chirps/search?q=go&author_id="+bob.ID, "", nil, &byAuthor); code != 200 {
+		t.Fatalf("search by author: expected 200, got %d", code)
+	}
+	if len(byAuthor.Chirps) != 1 || byAuthor.Chirps[0].UserID != bob.ID {
+		t.Fatalf("expected bob's single match, got %+v", byAuthor.Chirps)
+	}
+
+	if code := doJSON(t, srv, "GET", "/api/chirps/search?q=", "", nil, nil); code != 400 {
+		t.Fatalf("empty query: expected 400, got %d", code)
+	}
+}
+
+func TestSearchSnippetEscapesHTML(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	postChirp(t, srv, alice, "gopher <img src=x onerror=alert(1)> \ue000<script>gopher</script>")
+
+	var page struct {
+		Chirps []struct {
+			Body    string `json:"body"`
+			Snippet string `json:"snippet"`
+		} `json:"chirps"`
+	}
+	if code := doJSON(t, srv, "GET", "/api/chirps/search?q=gopher", "", nil, &page); code != 200 {
+		t.Fatalf("search: expected 200, got %d", code)
+	}
+	if len(page.Chirps) != 1 {
+		t.Fatalf("expected 1 result, got %+v", page.Chirps)
+	}
+	want := "<mark>gopher</mark> &lt;img src=x onerror=alert(1)&gt; &lt;script&gt;<mark>gopher</mark>&lt;/script&gt;"
+	if page.Chirps[0].Snippet != want {
+		t.Fatalf("expected escaped snippet %q, got %q", want, page.Chirps[0].Snippet)
+	}
+}
+
+func TestFollowAndTimeline(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+	carol := signup(t, srv, "carol@example.com")
+	postChirp(t, srv, bob, "bob one")
+	postChirp(t, srv, carol, "carol one")
+	postChirp(t, srv, bob, "bob two")
+
+	auth := "Bearer " + alice.Token
+	if code := doJSON(t, srv, "POST", "/api/users/"+bob.ID+"/follow", auth, nil, nil); code != 204 {
+		t.Fatalf("follow: expected 204, got %d", code)
+	}
+	if code := doJSON(t, srv, "POST", "/api/users/"+bob.ID+"/follow", auth, nil, nil); code != 204 {
+		t.Fatalf("repeat follow: expected 204, got %d", code)
+	}
+	if code := doJSON(t, srv, "POST", "/api/users/"+alice.ID+"/follow", auth, nil, nil); code != 400 {
+		t.Fatalf("self follow: expected 400, got %d", code)
+	}
+	missing := "/api/users/00000000-0000-0000-0000-000000000000/follow"
+	if code := doJSON(t, srv, "POST", missing, auth, nil, nil); code != 404 {
+		t.Fatalf("follow unknown user: expected 404, got %d", code)
+	}
+
+	timeline := testChirpPage{}
+	if code := doJSON(t, srv, "GET", "/api/timeline", auth, nil, &timeline); code != 200 {
+		t.Fatalf("timeline: expected 200, got %d", code)
+	}
+	if len(timeline.Chirps) != 2 || timeline.Chirps[0].Body != "bob two" {
+		t.Fatalf("expected bob's chirps newest first, got %+v", timeline.Chirps)
+	}
+
+	followers := struct {
+		Users []struct {
+			UserID string `json:"user_id"`
+		} `json:"users"`
+	}{}
+	if code := doJSON(t, srv, "GET", "/api/users/"+bob.ID+"/followers", "", nil, &followers); code != 200 {
+		t.Fatalf("followers: expected 200, got %d", code)
+	}
+	if len(followers.Users) != 1 || followers.Users[0].UserID != alice.ID {
+		t.Fatalf("expected alice as bob's only follower, got %+v", followers.Users)
+	}
+
+	if code := doJSON(t, srv, "DELETE", "/api/users/"+bob.ID+"/follow", auth, nil, nil); code != 204 {
+		t.Fatalf("unfollow: expected 204, got %d", code)
+	}
+	empty := testChirpPage{}
+	if code := doJSON(t, srv, "GET", "/api/timeline", auth, nil, &empty); code != 200 {
+		t.Fatalf("timeline after unfollow: expected 200, got %d", code)
+	}
+	if len(empty.Chirps) != 0 {
+		t.Fatalf("expected empty timeline after unfollow, got %+v", empty.Chirps)
+	}
+}
+
+func TestChirpThreadAndTombstone(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+	root := postChirp(t, srv, alice, "root")
+	reply := postReply(t, srv, bob, root.ID, "reply")
+	nested := postReply(t, srv, alice, reply.ID, "nested")
+	postReply(t, srv, bob, root.ID, "second reply")
+
+	if reply.ReplyTo == nil || *reply.ReplyTo != root.ID {
+		t.Fatalf("expected reply_to %s, got %v", root.ID, reply.ReplyTo)
+	}
+
+	thread := struct {
+		Ancestors []testChirp `json:"ancestors"`
+		Chirp     testChirp   `json:"chirp"`
+		Replies   []struct {
+			testChirp
+			Replies []struct {
+				testChirp
+			} `json:"replies"`
+		} `json:"replies"`
+	}{}
+	if code := doJSON(t, srv, "GET", "/api/chirps/"+reply.ID+"/thread", "", nil, &thread); code != 200 {
+		t.Fatalf("thread: expected 200, got %d", code)
+	}
+	if len(thread.Ancestors) != 1 || thread.Ancestors[0].ID != root.ID {
+		t.Fatalf("expected root as only ancestor, got %+v", thread.Ancestors)
+	}
+	if thread.Ancestors[0].ReplyCount != 2 {
+		t.Fatalf("expected root reply_count 2, got %d", thread.Ancestors[0].ReplyCount)
+	}
+	if len(thread.Replies) != 1 || thread.Replies[0].ID != nested.ID {
+		t.Fatalf("expected nested reply under reply, got %+v", thread.Replies)
+	}
+
+	if code := doJSON(t, srv, "DELETE", "/api/chirps/"+root.ID, "Bearer "+alice.Token, nil, nil); code != 204 {
+		t.Fatalf("delete root: expected 204, got %d", code)
+	}
+	if code := doJSON(t, srv, "GET", "/api/chirps/"+root.ID, "", nil, nil); code != 404 {
+		t.Fatalf("get tombstone: expected 404, got %d", code)
+	}
+	if code := doJSON(t, srv, "GET", "/api/chirps/"+reply.ID+"/thread", "", nil, &thread); code != 200 {
+		t.Fatalf("thread after delete: expected 200, got %d", code)
+	}
+	if len(thread.Ancestors) != 1 || !thread.Ancestors[0].Deleted || thread.Ancestors[0].Body != "" {
+		t.Fatalf("expected root to remain as a tombstone, got %+v", thread.Ancestors)
+	}
+
+	req := map[string]string{"body": "too late", "reply_to": root.ID}
+	if code := doJSON(t, srv, "POST", "/api/chirps", "Bearer "+bob.Token, req, nil); code != 400 {
+		t.Fatalf("reply to tombstone: expected 400, got %d", code)
+	}
+}
+
+func TestLikesAndRechirps(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+	chirp := postChirp(t, srv, alice, "like me")
+	path := "/api/chirps/" + chirp.ID
+
+	for i := 0; i < 2; i++ {
+		if code := doJSON(t, srv, "POST", path+"/like", "Bearer "+bob.Token, nil, nil); code != 204 {
+			t.Fatalf("like: expected 204, got %d", code)
+		}
+	}
+	if code := doJSON(t, srv, "POST", path+"/rechirp", "Bearer "+bob.Token, nil, nil); code != 204 {
+		t.Fatalf("rechirp: expected 204, got %d", code)
+	}
+	if code := doJSON(t, srv, "POST", path+"/like", "", nil, nil); code != 401 {
+		t.Fatalf("anonymous like: expected 401, got %d", code)
+	}
+
+	got := testChirp{}
+	if code := doJSON(t, srv, "GET", path, "Bearer "+bob.Token, nil, &got); code != 200 {
+		t.Fatalf("get chirp: expected 200, got %d", code)
+	}
+	if got.LikeCount != 1 || got.RechirpCount != 1 {
+		t.Fatalf("expected 1 like and 1 rechirp, got %+v", got)
+	}
+	if got.LikedByMe == nil || !*got.LikedByMe {
+		t.Fatalf("expected liked_by_me for bob, got %v", got.LikedByMe)
+	}
+
+	page := testChirpPage{}
+	if code := doJSON(t, srv, "GET", "/api/chirps", "Bearer "+alice.Token, nil, &page); code != 200 {
+		t.Fatalf("list chirps: expected 200, got %d", code)
+	}
+	if len(page.Chirps) != 1 || page.Chirps[0].LikedByMe == nil || *page.Chirps[0].LikedByMe {
+		t.Fatalf("expected liked_by_me false for alice, got %+v", page.Chirps)
+	}
+
+	anonymous := testChirp{}
+	if code := doJSON(t, srv, "GET", path, "", nil, &anonymous); code != 200 {
+		t.Fatalf("anonymous get chirp: expected 200, got %d", code)
+	}
+	if anonymous.LikedByMe != nil {
+		t.Fatalf("expected liked_by_me to be omitted for anonymous viewers")
+	}
+
+	if code := doJSON(t, srv, "DELETE", path+"/like", "Bearer "+bob.Token, nil, nil); code != 204 {
+		t.Fatalf("unlike: expected 204, got %d", code)
+	}
+	if code := doJSON(t, srv, "GET", path, "", nil, &got); code != 200 || got.LikeCount != 0 {
+		t.Fatalf("expected like_count 0 after unlike, got %d (status %d)", got.LikeCount, code)
+	}
+}
+
+func TestEditChirpRevisions(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+	chirp := postChirp(t, srv, alice, "first draft")
+	if chirp.Edited {
+		t.Fatalf("new chirp should not be marked edited")
+	}
+	path := "/api/chirps/" + chirp.ID
+
+	if code := doJSON(t, srv, "PUT", path, "Bearer "+bob.Token, map[string]string{"body": "hijacked"}, nil); code != 403 {
+		t.Fatalf("edit by non-owner: expected 403, got %d", code)
+	}
+	long := string(bytes.Repeat([]byte("a"), 141))
+	if code := doJSON(t, srv, "PUT", path, "Bearer "+alice.Token, map[string]string{"body": long}, nil); code != 400 {
+		t.Fatalf("long edit: expected 400, got %d", code)
+	}
+
+	edited := testChirp{}
+	if code := doJSON(t, srv, "PUT", path, "Bearer "+alice.Token, map[string]string{"body": "second kerfuffle"}, &edited); code != 200 {
+		t.Fatalf("edit: expected 200, got %d", code)
+	}
+	if edited.Body != "second ****" || !edited.Edited {
+		t.Fatalf("expected masked, edited chirp, got %+v", edited)
+	}
+	doJSON(t, srv, "PUT", path, "Bearer "+alice.Token, map[string]string{"body": "third"}, nil)
+	doJSON(t, srv, "PUT", path, "Bearer "+alice.Token, map[string]string{"body": "third"}, nil)
+
+	fetched := testChirp{}
+	doJSON(t, srv, "GET", path, "", nil, &fetched)
+	if fetched.Body != "third" || !fetched.Edited {
+		t.Fatalf("expected edited body on fetch, got %+v", fetched)
+	}
+
+	var revs struct {
+		Revisions []struct {
+			Body string `json:"body"`
+		} `json:"revisions"`
+	}
+	if code := doJSON(t, srv, "GET", path+"/revisions", "", nil, &revs); code != 200 {
+		t.Fatalf("revisions: expected 200, got %d", code)
+	}
+	got := []string{}
+	for _, rev := range revs.Revisions {
+		got = append(got, rev.Body)
+	}
+	if strings.Join(got, "|") != "second ****|first draft" {
+		t.Fatalf("expected prior bodies newest first, got %q", got)
+	}
+
+	doJSON(t, srv, "DELETE", path, "Bearer "+alice.Token, nil, nil)
+	if code := doJSON(t, srv, "PUT", path, "Bearer "+alice.Token, map[string]string{"body": "zombie"}, nil); code != 404 {
+		t.Fatalf("edit deleted chirp: expected 404, got %d", code)
+	}
+	if code := doJSON(t, srv, "GET", path+"/revisions", "", nil, nil); code != 404 {
+		t.Fatalf("revisions of deleted chirp: expected 404, got %d", code)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+	chirp := postChirp(t, srv, alice, "hello")
+	long := string(bytes.Repeat([]byte("a"), 141))
+
+	expectError(t, srv, "POST", "/api/chirps", "", map[string]string{"body": "hi"}, 401, "missing_authorization")
+	expectError(t, srv, "POST", "/api/chirps", "Bearer not-a-jwt", map[string]string{"body": "hi"}, 401, "invalid_token")
+	expectError(t, srv, "POST", "/api/chirps", "Bearer "+alice.Token, map[string]string{"body": long}, 400, "chirp_too_long")
+	expectError(t, srv, "POST", "/api/chirps", "Bearer "+alice.Token, map[string]string{"body": "hi", "reply_to": "00000000-0000-0000-0000-000000000000"}, 400, "invalid_reply_to")
+	expectError(t, srv, "DELETE", "/api/chirps/"+chirp.ID, "Bearer "+bob.Token, nil, 403, "not_owner")
+	expectError(t, srv, "GET", "/api/chirps/not-a-uuid", "", nil, 404, "chirp_not_found")
+	expectError(t, srv, "GET", "/api/chirps?limit=0", "", nil, 400, "invalid_query")
+	expectError(t, srv, "POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "wrong"}, 401, "invalid_credentials")
+	expectError(t, srv, "POST", "/api/refresh", "Bearer bogus", nil, 401, "invalid_refresh_token")
+	expectError(t, srv, "POST", "/api/users/"+alice.ID+"/follow", "Bearer "+alice.Token, nil, 400, "self_follow")
+	expectError(t, srv, "GET", "/admin/moderation/words", "ApiKey wrong", nil, 401, "invalid_api_key")
+}
+
+func TestStatusMapping(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	signup(t, srv, "bob@example.com")
+
+	for _, path := range []string{"/api/users", "/api/login"} {
+		expectError(t, srv, "POST", path, "", `{"email": `, 400, "invalid_json")
+		expectError(t, srv, "POST", path, "", "", 400, "invalid_json")
+		expectError(t, srv, "POST", path, "", `{"email": 42}`, 400, "invalid_json")
+	}
+	expectError(t, srv, "POST", "/api/chirps", "Bearer "+alice.Token, `{"body": "hi",}`, 400, "invalid_json")
+	expectError(t, srv, "POST", "/api/chirps", "Bearer "+alice.Token, `{"body": "hi", "reply_to": "nope"}`, 400, "invalid_json")
+	expectError(t, srv, "PUT", "/api/users", "Bearer "+alice.Token, `[]`, 400, "invalid_json")
+
+	creds := map[string]string{"email": "alice@example.com", "password": "hunter2"}
+	expectError(t, srv, "POST", "/api/users", "", creds, 409, "email_taken")
+	creds["email"] = "bob@example.com"
+	expectError(t, srv, "PUT", "/api/users", "Bearer "+alice.Token, creds, 409, "email_taken")
+
+	expectError(t, srv, "POST", "/api/login", "", map[string]string{"email": "nobody@example.com", "password": "x"}, 401, "invalid_credentials")
+	webhook := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": "00000000-0000-0000-0000-000000000000"}}
+	expectError(t, srv, "POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey, webhook, 404, "user_not_found")
+}
+
+func TestEmailVerificationAndPasswordReset(t *testing.T) {
+	srv := newTestServer(t)
+	creds := map[string]string{"email": "alice@example.com", "password": "hunter2"}
+	var created struct {
+		EmailVerified bool `json:"email_verified"`
+	}
+	if code := doJSON(t, srv, "POST", "/api/users", "", creds, &created); code != 201 {
+		t.Fatalf("create user: expected 201, got %d", code)
+	}
+	if created.EmailVerified {
+		t.Fatalf("expected a new user to be unverified")
+	}
+	expectError(t, srv, "POST", "/api/login", "", creds, 403, "email_not_verified")
+
+	// Resending replaces the first token.
+	first := lastEmailToken(t, srv, "alice@example.com")
+	if code := doJSON(t, srv, "POST", "/api/verify-email/resend", "", map[string]string{"email": "alice@example.com"}, nil); code != 202 {
+		t.Fatalf("resend: expected 202, got %d", code)
+	}
+	if code := doJSON(t, srv, "POST", "/api/verify-email/resend", "", map[string]string{"email": "nobody@example.com"}, nil); code != 202 {
+		t.Fatalf("resend for unknown email: expected 202, got %d", code)
+	}
+	expectError(t, srv, "POST", "/api/verify-email", "", map[string]string{"token": first}, 400, "invalid_email_token")
+	verifyEmail(t, srv, "alice@example.com")
+	expectError(t, srv, "POST", "/api/verify-email", "", map[string]string{"token": lastEmailToken(t, srv, "alice@example.com")}, 400, "invalid_email_token")
+	alice := login(t, srv, "alice@example.com")
+
+	// A verification token cannot reset a password, and vice versa.
+	if code := doJSON(t, srv, "POST", "/api/password-reset", "", map[string]string{"email": "nobody@example.com"}, nil); code != 202 {
+		t.Fatalf("reset for unknown email: expected 202, got %d", code)
+	}
+	if code := doJSON(t, srv, "POST", "/api/password-reset", "", map[string]string{"email": "alice@example.com"}, nil); code != 202 {
+		t.Fatalf("request reset: expected 202, got %d", code)
+	}
+	reset := lastEmailToken(t, srv, "alice@example.com")
+	expectError(t, srv, "POST", "/api/verify-email", "", map[string]string{"token": reset}, 400, "invalid_email_token")
+	expectError(t, srv, "POST", "/api/password-reset/confirm", "", map[string]string{"token": reset, "password": ""}, 400, "invalid_password")
+	confirm := map[string]string{"token": reset, "password": "correct horse"}
+	if code := doJSON(t, srv, "POST", "/api/password-reset/confirm", "", confirm, nil); code != 204 {
+		t.Fatalf("confirm reset: expected 204, got %d", code)
+	}
+	expectError(t, srv, "POST", "/api/password-reset/confirm", "", confirm, 400, "invalid_email_token")
+	expectError(t, srv, "POST", "/api/refresh", "Bearer "+alice.RefreshToken, nil, 401, "invalid_refresh_token")
+	expectError(t, srv, "POST", "/api/login", "", creds, 401, "invalid_credentials")
+	creds["password"] = "correct horse"
+	if code := doJSON(t, srv, "POST", "/api/login", "", creds, &alice); code != 200 {
+		t.Fatalf("login with new password: expected 200, got %d", code)
+	}
+
+	// Changing the email needs the new address verified before the next login.
+	creds["email"] = "alice@example.org"
+	var updated struct {
+		EmailVerified bool `json:"email_verified"`
+	}
+	if code := doJSON(t, srv, "PUT", "/api/users", "Bearer "+alice.Token, creds, &updated); code != 200 {
+		t.Fatalf("update email: expected 200, got %d", code)
+	}
+	if updated.EmailVerified {
+		t.Fatalf("expected the new email to be unverified")
+	}
+	expectError(t, srv, "POST", "/api/login", "", creds, 403, "email_not_verified")
+	verifyEmail(t, srv, "alice@example.org")
+	if code := doJSON(t, srv, "POST", "/api/login", "", creds, nil); code != 200 {
+		t.Fatalf("login after verifying new email: expected 200, got %d", code)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	signup(t, srv, "bob@example.com")
+	key := "ApiKey " + testAdminKey
+
+	// Known and unknown emails are throttled the same way.
+	for _, email := range []string{"alice@example.com", "nobody@example.com"} {
+		wrong := map[string]string{"email": email, "password": "wrong"}
+		for i := 0; i < auth.AccountLockout.LockAfter; i++ {
+			expectError(t, srv, "POST", "/api/login", "", wrong, 401, "invalid_credentials")
+		}
+		expectError(t, srv, "POST", "/api/login", "", wrong, 401, "login_locked")
+	}
+	// The right password does not get through a lock either.
+	right := map[string]string{"email": "alice@example.com", "password": "hunter2"}
+	data, _ := json.Marshal(right)
+	resp, err := http.Post(srv.URL+"/api/login", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("login request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 401 || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected 401 with Retry-After, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	var list struct {
+		Locks []struct {
+			Scope   string  `json:"scope"`
+			Subject string  `json:"subject"`
+			UserID  *string `json:"user_id"`
+		} `json:"locks"`
+	}
+	if code := doJSON(t, srv, "GET", "/admin/lockouts", key, nil, &list); code != 200 {
+		t.Fatalf("list lockouts: expected 200, got %d", code)
+	}
+	users := map[string]bool{}
+	for _, l := range list.Locks {
+		users[l.Subject] = l.UserID != nil
+	}
+	if len(list.Locks) != 2 || !users["alice@example.com"] || users["nobody@example.com"] {
+		t.Fatalf("expected alice and nobody locked, got %+v", list.Locks)
+	}
+
+	if code := doJSON(t, srv, "POST", "/admin/users/"+alice.ID+"/unlock", key, nil, nil); code != 200 {
+		t.Fatalf("unlock: expected 200, got %d", code)
+	}
+	login(t, srv, "alice@example.com")
+
+	// Enough failures from one address lock it for every account. The IP
+	// already has the failures made against alice and nobody above.
+	for i := 2 * auth.AccountLockout.LockAfter; i < auth.IPLockout.LockAfter; i++ {
+		wrong := map[string]string{"email": fmt.Sprintf("user%d@example.com", i), "password": "wrong"}
+		expectError(t, srv, "POST", "/api/login", "", wrong, 401, "invalid_credentials")
+	}
+	expectError(t, srv, "POST", "/api/login", "", map[string]string{"email": "bob@example.com", "password": "hunter2"}, 401, "login_locked")
+}
+
+type testTwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type testRecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type testLoginChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	Token             string `json:"token"`
+}
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := auth.TOTPCode(secret, at)
+	if err != nil {
+		t.Fatalf("TOTPCode returned error: %v", err)
+	}
+	return code
+}
+
+// enableTwoFactor enrolls user and returns the secret and recovery codes.
+func enableTwoFactor(t *testing.T, srv *testServer, user testUser) (string, []string) {
+	t.Helper()
+	setup := testTwoFactorSetup{}
+	if code := doJSON(t, srv, "POST", "/api/users/2fa/setup", "Bearer "+user.Token, nil, &setup); code != 200 {
+		t.Fatalf("2fa setup: expected 200, got %d", code)
+	}
+	codes := testRecoveryCodes{}
+	req := map[string]string{"code": totpCode(t, setup.Secret, time.Now())}
+	if code := doJSON(t, srv, "POST", "/api/users/2fa/confirm", "Bearer "+user.Token, req, &codes); code != 200 {
+		t.Fatalf("2fa confirm: expected 200, got %d", code)
+	}
+	return setup.Secret, codes.RecoveryCodes
+}
+
+func loginChallenge(t *testing.T, srv *testServer, email string) string {
+	t.Helper()
+	creds := map[string]string{"email": email, "password": "hunter2"}
+	out := testLoginChallenge{}
+	if code := doJSON(t, srv, "POST", "/api/login", "", creds, &out); code != 200 {
+		t.Fatalf("login: expected 200, got %d", code)
+	}
+	if !out.TwoFactorRequired || out.ChallengeToken == "" || out.Token != "" {
+		t.Fatalf("expected a challenge and no tokens, got %+v", out)
+	}
+	return out.ChallengeToken
+}
+
+func TestTwoFactorAuthentication(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	bearer := "Bearer " + alice.Token
+
+	expectError(t, srv, "POST", "/api/users/2fa/confirm", bearer, map[string]string{"code": "123456"}, 400, "two_factor_not_set_up")
+	setup := testTwoFactorSetup{}
+	if code := doJSON(t, srv, "POST", "/api/users/2fa/setup", bearer, nil, &setup); code != 200 {
+		t.Fatalf("2fa setup: expected 200, got %d", code)
+	}
+	if !strings.HasPrefix(setup.OtpauthURI, "otpauth://totp/Chirpy:alice@example.com?") || !strings.Contains(setup.OtpauthURI, "secret="+setup.Secret) {
+		t.Fatalf("unexpected otpauth URI %q", setup.OtpauthURI)
+	}
+	// Login is unchanged until enrollment is confirmed.
+	login(t, srv, "alice@example.com")
+	expectError(t, srv, "POST", "/api/users/2fa/confirm", bearer, map[string]string{"code": "12345"}, 400, "invalid_two_factor_code")
+
+	used := totpCode(t, setup.Secret, time.Now())
+	codes := testRecoveryCodes{}
+	if code := doJSON(t, srv, "POST", "/api/users/2fa/confirm", bearer, map[string]string{"code": used}, &codes); code != 200 {
+		t.Fatalf("2fa confirm: expected 200, got %d", code)
+	}
+	recovery := codes.RecoveryCodes
+	if len(recovery) != 10 {
+		t.Fatalf("expected 10 recovery codes, got %v", recovery)
+	}
+	expectError(t, srv, "POST", "/api/users/2fa/setup", bearer, nil, 409, "two_factor_enabled")
+
+	// The code used to confirm cannot be replayed; the next one works once.
+	challenge := loginChallenge(t, srv, "alice@example.com")
+	next := totpCode(t, setup.Secret, time.Now().Add(30*time.Second))
+	expectError(t, srv, "POST", "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": used}, 401, "invalid_two_factor_code")
+	var tokens testTokens
+	if code := doJSON(t, srv, "POST", "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": next}, &tokens); code != 200 {
+		t.Fatalf("login with totp: expected 200, got %d", code)
+	}
+	if tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Fatalf("expected tokens, got %+v", tokens)
+	}
+	expectError(t, srv, "POST", "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": next}, 401, "invalid_challenge")
+
+	// Recovery codes work once each, however they are typed.
+	challenge = loginChallenge(t, srv, "alice@example.com")
+	typed := strings.ToUpper(recovery[0])
+	if code := doJSON(t, srv, "POST", "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": typed}, nil); code != 200 {
+		t.Fatalf("login with recovery code: expected 200, got %d", code)
+	}
+	challenge = loginChallenge(t, srv, "alice@example.com")
+	expectError(t, srv, "POST", "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": recovery[0]}, 401, "invalid_two_factor_code")
+	var status struct {
+		Enabled                bool `json:"enabled"`
+		RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+	}
+	if code := doJSON(t, srv, "GET", "/api/users/2fa", bearer, nil, &status); code != 200 {
+		t.Fatalf("2fa status: expected 200, got %d", code)
+	}
+	if !status.Enabled || status.RecoveryCodesRemaining != 9 {
+		t.Fatalf("expected 2fa enabled with 9 recovery codes, got %+v", status)
+	}
+
+	// Regenerating invalidates the old codes.
+	fresh := testRecoveryCodes{}
+	if code := doJSON(t, srv, "POST", "/api/users/2fa/recovery-codes", bearer, map[string]string{"code": recovery[1]}, &fresh); code != 200 {
+		t.Fatalf("regenerate recovery codes: expected 200, got %d", code)
+	}
+	expectError(t, srv, "POST", "/api/users/2fa/disable", bearer, map[string]string{"code": recovery[2]}, 400, "invalid_two_factor_code")
+	if code := doJSON(t, srv, "POST", "/api/users/2fa/disable", bearer, map[string]string{"code": fresh.RecoveryCodes[0]}, nil); code != 204 {
+		t.Fatalf("disable 2fa: expected 204, got %d", code)
+	}
+	login(t, srv, "alice@example.com")
+}
+
+func TestTwoFactorChallengeLimits(t *testing.T) {
+	srv := newTestServer(t)
+	bob := signup(t, srv, "bob@example.com")
+	_, recovery := enableTwoFactor(t, srv, bob)
+
+	// A challenge dies after 5 wrong codes, and they count as failed logins.
+	challenge := loginChallenge(t, srv, "bob@example.com")
+	for i := 0; i < 5; i++ {
+		expectError(t, srv, "POST", "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": "wrong"}, 401, "invalid_two_factor_code")
+	}
+	expectError(t, srv, "POST", "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": recovery[0]}, 401, "invalid_challenge")
+	creds := map[string]string{"email": "bob@example.com", "password": "hunter2"}
+	expectError(t, srv, "POST", "/api/login", "", creds, 401, "login_locked")
+
+	key := "ApiKey " + testAdminKey
+	if code := doJSON(t, srv, "POST", "/admin/users/"+bob.ID+"/unlock", key, nil, nil); code != 200 {
+		t.Fatalf("unlock: expected 200, got %d", code)
+	}
+	if code := doJSON(t, srv, "POST", "/admin/users/"+bob.ID+"/2fa/reset", key, nil, nil); code != 204 {
+		t.Fatalf("reset 2fa: expected 204, got %d", code)
+	}
+	login(t, srv, "bob@example.com")
+}
+
+func TestTwoFactorSettingsLockout(t *testing.T) {
+	srv := newTestServer(t)
+	bob := signup(t, srv, "bob@example.com")
+	_, recovery := enableTwoFactor(t, srv, bob)
+	bearer := "Bearer " + bob.Token
+
+	// Wrong codes from a logged-in session lock the account like wrong
+	// codes at login, and then even a right code is refused.
+	wrong := map[string]string{"code": "wrong"}
+	for i := 0; i < auth.AccountLockout.LockAfter; i++ {
+		expectError(t, srv, "POST", "/api/users/2fa/disable", bearer, wrong, 400, "invalid_two_factor_code")
+	}
+	expectError(t, srv, "POST", "/api/users/2fa/disable", bearer, map[string]string{"code": recovery[0]}, 401, "login_locked")
+	expectError(t, srv, "POST", "/api/users/2fa/recovery-codes", bearer, map[string]string{"code": recovery[0]}, 401, "login_locked")
+	creds := map[string]string{"email": "bob@example.com", "password": "hunter2"}
+	expectError(t, srv, "POST", "/api/login", "", creds, 401, "login_locked")
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := newConfiguredTestServer(t, moderation.ModeMask, func(cfg *apiConfig) {
+		cfg.rateLimiter = ratelimit.NewMemory()
+		cfg.rateLimits = map[string]ratelimit.Policy{
+			defaultRateLimit:   {Limit: 1000, Window: time.Minute},
+			"POST /api/login":  {Limit: 3, Window: time.Minute},
+			"POST /api/chirps": {Limit: 2, Window: time.Hour},
+		}
+	})
+	alice := signup(t, srv, "alice@example.com")
+	bob := signup(t, srv, "bob@example.com")
+
+	// Both signups logged in from the same IP, so one login is left.
+	creds := map[string]string{"email": "alice@example.com", "password": "hunter2"}
+	data, _ := json.Marshal(creds)
+	resp, err := http.Post(srv.URL+"/api/login", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("login request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("X-RateLimit-Limit") != "3" || resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("expected 200 with limit 3 and none remaining, got %d %v", resp.StatusCode, resp.Header)
+	}
+	resp, err = http.Post(srv.URL+"/api/login", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("login request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 429 || resp.Header.Get("Retry-After") != "20" || resp.Header.Get("X-RateLimit-Reset") == "" {
+		t.Fatalf("expected 429 with Retry-After 20, got %d %v", resp.StatusCode, resp.Header)
+	}
+	expectError(t, srv, "POST", "/api/login", "", creds, 429, "rate_limited")
+
+	// Authenticated requests count against the user, not the IP.
+	postChirp(t, srv, alice, "one")
+	postChirp(t, srv, alice, "two")
+	expectError(t, srv, "POST", "/api/chirps", "Bearer "+alice.Token, map[string]string{"body": "three"}, 429, "rate_limited")
+	postChirp(t, srv, bob, "one")
+	// Other routes have buckets of their own.
+	if code := doJSON(t, srv, "GET", "/api/chirps", "Bearer "+alice.Token, nil, nil); code != 200 {
+		t.Fatalf("list chirps: expected 200, got %d", code)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	srv := newTestServer(t)
+	alice := signup(t, srv, "alice@example.com")
+	chirp := postChirp(t, srv, alice, "hello")
+	if code := doJSON(t, srv, "GET", "/api/chirps/"+chirp.ID, "", nil, nil); code != 200 {
+		t.Fatalf("get chirp: expected 200, got %d", code)
+	}
+	expectError(t, srv, "GET", "/api/chirps/not-a-uuid", "", nil, 404, "chirp_not_found")
+	expectError(t, srv, "POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "wrong"}, 401, "invalid_credentials")
+	if code := doJSON(t, srv, "GET", "/no/such/route", "", nil, nil); code != 404 {
+		t.Fatalf("unknown route: expected 404, got %d", code)
+	}
+
+	expectError(t, srv, "GET", "/metrics", "", nil, 401, "missing_authorization")
+	expectError(t, srv, "GET", "/metrics", "Bearer "+alice.Token, nil, 403, "insufficient_scope")
+	req, err := http.NewRequest("GET", srv.URL+"/metrics", nil)
+	if err != nil {
+		t.Fatalf("NewRequest returned error: %v", err)
+	}
+	req.Header.Set("Authorization", "ApiKey "+testAdminKey)
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET /metrics returned error: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read metrics: %v", err)
+	}
+	if res.StatusCode != 200 || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("expected 200 text/plain, got %d %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`chirpy_http_requests_total{code="200",route="GET /api/chirps/{chirpID}"} 1`,
+		`chirpy_http_requests_total{code="404",route="GET /api/chirps/{chirpID}"} 1`,
+		`chirpy_http_requests_total{code="404",route="unmatched"} 1`,
+		`chirpy_http_request_duration_seconds_count{code="201",route="POST /api/chirps"} 1`,
+		`chirpy_chirps_created_total 1`,
+		`chirpy_login_failures_total 1`,
+		`chirpy_active_sessions 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("metrics output missing %q:\n%s", want, body)
+		}
+	}
+}
+
+// syncBuffer lets the server log into a buffer while the test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// lines decodes the JSON log lines written so far.
+func (b *syncBuffer) lines(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var lines []map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b.buf.Bytes()))
+	for dec.More() {
+		line := map[string]any{}
+		if err := dec.Decode(&line); err != nil {
+			t.Fatalf("decode log line: %v", err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRequestLogging(t *testing.T) {
+	logs := &syncBuffer{}
+	srv := newConfiguredTestServer(t, moderation.ModeMask, func(cfg *apiConfig) {
+		cfg.logger = slog.New(slog.NewJSONHandler(logs, nil))
+	})
+	alice := signup(t, srv, "alice@example.com")
+
+	get := func(path, requestID, authHeader string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		if err != nil {
+			t.Fatalf("NewRequest returned error: %v", err)
+		}
+		req.Header.Set("X-Request-ID", requestID)
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("GET %s returned error: %v", path, err)
+		}
+		res.Body.Close()
+		return res
+	}
+	// A usable request ID is kept and echoed; anything else is replaced.
+	if res := get("/api/timeline", "trace-42", "Bearer "+alice.Token); res.Header.Get("X-Request-ID") != "trace-42" {
+		t.Fatalf("expected the request ID to be echoed, got %q", res.Header.Get("X-Request-ID"))
+	}
+	res := get("/api/chirps/not-a-uuid", "<bad id>", "")
+	generated := res.Header.Get("X-Request-ID")
+	if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(generated) {
+		t.Fatalf("expected a generated request ID, got %q", generated)
+	}
+
+	requests := map[string]map[string]any{}
+	for _, line := range logs.lines(t) {
+		if line["msg"] == "request" {
+			requests[line["request_id"].(string)] = line
+		}
+	}
+	timeline := requests["trace-42"]
+	if timeline == nil || timeline["level"] != "INFO" || timeline["method"] != "GET" || timeline["path"] != "/api/timeline" ||
+		timeline["route"] != "GET /api/timeline" || timeline["status"] != float64(200) || timeline["user_id"] != alice.ID {
+		t.Fatalf("unexpected log line for the timeline request: %v", timeline)
+	}
+	if _, ok := timeline["duration_ms"].(float64); !ok {
+		t.Fatalf("expected a duration in %v", timeline)
+	}
+	missing := requests[generated]
+	if missing == nil || missing["route"] != "GET /api/chirps/{chirpID}" || missing["status"] != float64(404) ||
+		!strings.Contains(fmt.Sprint(missing["error"]), "invalid UUID") || missing["user_id"] != nil {
+		t.Fatalf("unexpected log line for the missing chirp: %v", missing)
+	}
+}
+
+// failingStore makes search wait until its context is done, as Postgres
+// does for a slow query, and the timeline fail as if the database were down.
+type failingStore struct {
+	storage.Store
+}
+
+func (failingStore) SearchChirps(ctx context.Context, arg database.SearchChirpsParams) ([]database.SearchChirpsRow, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (failingStore) ListTimeline(ctx context.Context, arg database.ListTimelineParams) ([]database.Chirp, error) {
+	return nil, &pq.Error{Code: "53300"}
+}
+
+func TestRequestTimeouts(t *testing.T) {
+	srv := newConfiguredTestServer(t, moderation.ModeMask, func(cfg *apiConfig) {
+		cfg.dbQueries = failingStore{cfg.dbQueries}
+		cfg.requestTimeout = time.Minute
+		cfg.routeTimeouts = map[string]time.Duration{"GET /api/chirps/search": 20 * time.Millisecond}
+	})
+	alice := signup(t, srv, "alice@example.com")
+
+	start := time.Now()
+	expectError(t, srv, "GET", "/api/chirps/search?q=hello", "", nil, 504, "timeout")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the route timeout to cut the search short, took %v", elapsed)
+	}
+	expectError(t, srv, "GET", "/api/timeline", "Bearer "+alice.Token, nil, 503, "service_unavailable")
+
+	routes := withRouteTimeoutDefaults(map[string]time.Duration{
+		"POST /api/login":        time.Second,
+		"GET /api/chirps/search": 250 * time.Millisecond,
+	})
+	if routes["POST /api/login"] != time.Second || routes["GET /api/chirps/search"] != 250*time.Millisecond ||
+		routes["GET /api/chirps/{chirpID}/thread"] != 5*time.Second {
+		t.Fatalf("unexpected timeouts %v", routes)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+	cfg := &apiConfig{requestTimeout: time.Second}
+	server := newServer("", mux, cfg)
+	if server.WriteTimeout != time.Second+writeTimeoutMargin || server.ReadHeaderTimeout == 0 || server.IdleTimeout == 0 {
+		t.Fatalf("unexpected server timeouts %+v", server)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, server, ln, 5*time.Second, slog.New(slog.DiscardHandler))
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	got := make(chan result, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			got <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		got <- result{string(body), err}
+	}()
+	<-started
+	cancel()
+	// Shutdown closes the listener before waiting for the request.
+	for {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			break
+		}
+		conn.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-served:
+		t.Fatalf("serve returned before the in-flight request finished: %v", err)
+	default:
+	}
+	close(release)
+	if r := <-got; r.err != nil || r.body != "done" {
+		t.Fatalf("expected the in-flight request to complete, got %q %v", r.body, r.err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("serve returned error: %v", err)
+	}
+}
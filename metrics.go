@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// activeSessionsTTL is how long a session count is reused across scrapes.
+const activeSessionsTTL = 30 * time.Second
+
+// HandlerMetrics serves the Prometheus metrics. The active session count is
+// a database query, so it is refreshed here, at most every
+// activeSessionsTTL, rather than on every login.
+func HandlerMetrics(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	if err := cfg.metrics.RefreshActiveSessions(r.Context(), activeSessionsTTL, cfg.dbQueries.CountActiveSessions); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	cfg.metrics.Handler().ServeHTTP(w, r)
+}
+
+// middlewareMetrics counts and times every request under the route pattern
+// that serves it.
+func (a *apiConfig) middlewareMetrics(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := routePattern(mux, r)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		a.metrics.ObserveRequest(route, rec.Status(), time.Since(start))
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/config"
+	"github.com/IArtMediums/chirp_project/internal/logging"
+	"github.com/IArtMediums/chirp_project/internal/migrate"
+)
+
+const migrateUsage = `usage: chirpy migrate [flags] <command>
+
+commands:
+  up             apply every pending migration
+  down           roll back the most recent migration
+  status         list migrations and whether they are applied
+  create <name>  add an empty migration to sql/schema, e.g. create add_user_bios
+
+Flags are the server's, such as -db-url and -config; see chirpy -h.
+`
+
+// runMigrate runs `chirpy migrate` with args, the arguments after "migrate",
+// and returns the exit code.
+func runMigrate(args []string, stdout, stderr io.Writer) int {
+	settings, rest, err := config.LoadCommand(args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(stderr, migrateUsage)
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if len(rest) == 0 {
+		fmt.Fprint(stderr, migrateUsage)
+		return 2
+	}
+	command, rest := rest[0], rest[1:]
+	if command == "create" {
+		if len(rest) != 1 {
+			fmt.Fprint(stderr, migrateUsage)
+			return 2
+		}
+		path, err := migrate.Create(migrate.Dir, rest[0])
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "created %s\n", path)
+		return 0
+	}
+	if len(rest) > 0 {
+		fmt.Fprint(stderr, migrateUsage)
+		return 2
+	}
+	switch command {
+	case "up", "down", "status":
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n%s", command, migrateUsage)
+		return 2
+	}
+	if settings.DBURL == "" {
+		fmt.Fprintln(stderr, "config: DB_URL is required")
+		return 2
+	}
+	db, err := sql.Open("postgres", settings.DBURL)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer db.Close()
+	migrator, err := migrate.New(db)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		results, err := migrator.Up(ctx)
+		for _, result := range results {
+			printMigrationResult(stdout, result.Source.Path, result.Duration, result.Error)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if len(results) == 0 {
+			fmt.Fprintf(stdout, "up to date at version %d\n", migrator.Latest())
+		}
+	case "down":
+		result, err := migrator.Down(ctx)
+		if result != nil {
+			printMigrationResult(stdout, result.Source.Path, result.Duration, result.Error)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if !status.AppliedAt.IsZero() {
+				applied = status.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(stdout, "%-20s  %s\n", applied, status.Source.Path)
+		}
+	}
+	return 0
+}
+
+func printMigrationResult(w io.Writer, path string, d time.Duration, err error) {
+	if err != nil {
+		fmt.Fprintf(w, "FAIL  %s: %v\n", path, err)
+		return
+	}
+	fmt.Fprintf(w, "OK    %s (%s)\n", path, d.Round(time.Millisecond))
+}
+
+// migrateOnStartup applies pending migrations if AUTO_MIGRATE is set, then
+// checks that the database schema is as new as the server's. The server
+// refuses to start against an older schema, whose missing tables and
+// columns would otherwise surface as 500s.
+func migrateOnStartup(ctx context.Context, db *sql.DB, settings *config.Config, logger *slog.Logger) error {
+	migrator, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+	if settings.AutoMigrate {
+		results, err := migrator.Up(ctx)
+		for _, result := range results {
+			if result.Error == nil {
+				logger.Info("applied migration", "migration", result.Source.Path, "duration_ms", logging.DurationMillis(result.Duration))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	current, latest, err := migrator.Check(ctx)
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		logger.Warn("database schema is newer than this server", "version", current, "latest", latest)
+		return nil
+	}
+	logger.Info("database schema is up to date", "version", current)
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/IArtMediums/chirp_project/internal/logging"
+	"github.com/IArtMediums/chirp_project/internal/moderation"
+	"github.com/IArtMediums/chirp_project/internal/storage"
+	"github.com/google/uuid"
+)
+
+// storeWordSource keeps the moderation word list in the profane_words table.
+type storeWordSource struct {
+	store storage.Store
+}
+
+func (s storeWordSource) LoadWords(ctx context.Context) ([]string, error) {
+	return s.store.ListProfaneWords(ctx)
+}
+
+func (s storeWordSource) AddWord(ctx context.Context, word string) error {
+	return s.store.AddProfaneWord(ctx, word)
+}
+
+func (s storeWordSource) RemoveWord(ctx context.Context, word string) error {
+	return s.store.RemoveProfaneWord(ctx, word)
+}
+
+// flagChirp records a moderation flag for chirpID when the filter runs in
+// flag mode and result has matches. Failures are logged rather than returned,
+// since the chirp itself has already been stored.
+func flagChirp(ctx context.Context, cfg *apiConfig, chirpID uuid.UUID, result moderation.Result) {
+	if !result.Matched() || cfg.moderation.Mode() != moderation.ModeFlag {
+		return
+	}
+	ctx, cancel := detachedContext(ctx)
+	defer cancel()
+	params := database.CreateModerationFlagParams{
+		ChirpID: chirpID,
+		Words: result.Matches,
+	}
+	if _, err := cfg.dbQueries.CreateModerationFlag(ctx, params); err != nil {
+		logging.FromContext(ctx).Error("flag chirp", "chirp_id", chirpID, "error", err)
+	}
+}
+
+func HandlerListModerationWords(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type response struct {
+		Mode	moderation.Mode	`json:"mode"`
+		Words	[]string		`json:"words"`
+	}
+	res := response{
+		Mode: cfg.moderation.Mode(),
+		Words: cfg.moderation.Words(),
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+func HandlerAddModerationWord(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type request struct {
+		Word	string	`json:"word"`
+	}
+	type response struct {
+		Word	string	`json:"word"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	word, err := moderation.NormalizeWord(req.Word)
+	if err != nil {
+		respondWithError(w, 400, codeInvalidWord, err.Error(), err)
+		return
+	}
+	ctx := r.Context()
+	if err := recordAudit(ctx, r, cfg, "moderation.add_word", "word", word, nil); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if _, err := cfg.moderation.AddWord(ctx, word); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	data, err := json.Marshal(&response{Word: word})
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	w.Write(data)
+}
+
+func HandlerRemoveModerationWord(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	word, err := moderation.NormalizeWord(r.PathValue("word"))
+	if err != nil {
+		respondWithError(w, 400, codeInvalidWord, err.Error(), err)
+		return
+	}
+	ctx := r.Context()
+	if err := recordAudit(ctx, r, cfg, "moderation.remove_word", "word", word, nil); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if err := cfg.moderation.RemoveWord(ctx, word); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func HandlerListModerationFlags(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type flag struct {
+		ID			uuid.UUID	`json:"id"`
+		ChirpID		uuid.UUID	`json:"chirp_id"`
+		Words		[]string	`json:"words"`
+		CreatedAt	time.Time	`json:"created_at"`
+	}
+	type response struct {
+		Flags		[]flag	`json:"flags"`
+		NextCursor	string	`json:"next_cursor,omitempty"`
+	}
+	page, err := parseNewestFirstPage(r.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, codeInvalidQuery, err.Error(), err)
+		return
+	}
+	params := database.ListModerationFlagsParams{
+		Limit: int32(page.Limit + 1),
+	}
+	params.CursorCreatedAt, params.CursorID = keysetArgs(page.Cursor)
+	flags, err := cfg.dbQueries.ListModerationFlags(r.Context(), params)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	res := response{Flags: []flag{}}
+	if len(flags) > page.Limit {
+		flags = flags[:page.Limit]
+		last := flags[len(flags)-1]
+		res.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, f := range flags {
+		res.Flags = append(res.Flags, flag{
+			ID: f.ID,
+			ChirpID: f.ChirpID,
+			Words: f.Words,
+			CreatedAt: f.CreatedAt,
+		})
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultPageLimit = 20
+const maxPageLimit = 100
+
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+type searchCursor struct {
+	Rank float32
+	pageCursor
+}
+
+type pageParams struct {
+	Cursor *pageCursor
+	Limit  int
+	Desc   bool
+}
+
+// encodeCursor returns an opaque token pointing just past the given row.
+func encodeCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor: %v", err)
+	}
+	split := strings.SplitN(string(raw), "|", 2)
+	if len(split) != 2 {
+		return pageCursor{}, fmt.Errorf("invalid cursor format")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, split[0])
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor timestamp: %v", err)
+	}
+	id, err := uuid.Parse(split[1])
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor id: %v", err)
+	}
+	return pageCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// encodeSearchCursor is encodeCursor for relevance-ordered results, where the
+// rank is the leading keyset column.
+func encodeSearchCursor(rank float32, createdAt time.Time, id uuid.UUID) string {
+	raw := strconv.FormatFloat(float64(rank), 'g', -1, 32) + "|" + encodeCursor(createdAt, id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSearchCursor(cursor string) (searchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return searchCursor{}, fmt.Errorf("invalid cursor: %v", err)
+	}
+	split := strings.SplitN(string(raw), "|", 2)
+	if len(split) != 2 {
+		return searchCursor{}, fmt.Errorf("invalid cursor format")
+	}
+	rank, err := strconv.ParseFloat(split[0], 32)
+	if err != nil {
+		return searchCursor{}, fmt.Errorf("invalid cursor rank: %v", err)
+	}
+	c, err := decodeCursor(split[1])
+	if err != nil {
+		return searchCursor{}, err
+	}
+	return searchCursor{Rank: float32(rank), pageCursor: c}, nil
+}
+
+func parseLimit(query url.Values) (int, error) {
+	limit := query.Get("limit")
+	if limit == "" {
+		return defaultPageLimit, nil
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid limit: %q", limit)
+	}
+	if n > maxPageLimit {
+		n = maxPageLimit
+	}
+	return n, nil
+}
+
+// parsePageParams reads the cursor, limit and sort query parameters shared by
+// every paginated list endpoint.
+func parsePageParams(query url.Values) (pageParams, error) {
+	params, err := parseNewestFirstPage(query)
+	if err != nil {
+		return pageParams{}, err
+	}
+	switch sort := query.Get("sort"); sort {
+	case "", "asc":
+		params.Desc = false
+	case "desc":
+	default:
+		return pageParams{}, fmt.Errorf("invalid sort: %q", sort)
+	}
+	return params, nil
+}
+
+// parseNewestFirstPage reads the cursor and limit query parameters for lists
+// that are always ordered newest first.
+func parseNewestFirstPage(query url.Values) (pageParams, error) {
+	limit, err := parseLimit(query)
+	if err != nil {
+		return pageParams{}, err
+	}
+	params := pageParams{Limit: limit, Desc: true}
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return pageParams{}, err
+		}
+		params.Cursor = &c
+	}
+	return params, nil
+}
+
+// keysetArgs converts an optional cursor into the nullable query arguments
+// used by the keyset queries.
+func keysetArgs(cursor *pageCursor) (sql.NullTime, uuid.NullUUID) {
+	if cursor == nil {
+		return sql.NullTime{}, uuid.NullUUID{}
+	}
+	return sql.NullTime{Time: cursor.CreatedAt, Valid: true}, uuid.NullUUID{UUID: cursor.ID, Valid: true}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC)
+	id := uuid.New()
+
+	got, err := decodeCursor(encodeCursor(createdAt, id))
+	if err != nil {
+		t.Fatalf("decodeCursor returned error: %v", err)
+	}
+	if !got.CreatedAt.Equal(createdAt) {
+		t.Fatalf("expected created_at %v, got %v", createdAt, got.CreatedAt)
+	}
+	if got.ID != id {
+		t.Fatalf("expected id %v, got %v", id, got.ID)
+	}
+}
+
+func TestParsePageParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantLimit int
+		wantDesc  bool
+		wantErr   bool
+	}{
+		{name: "defaults", query: "", wantLimit: defaultPageLimit},
+		{name: "explicit limit", query: "limit=5", wantLimit: 5},
+		{name: "limit is capped", query: "limit=1000", wantLimit: maxPageLimit},
+		{name: "desc sort", query: "sort=desc", wantLimit: defaultPageLimit, wantDesc: true},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "non-numeric limit", query: "limit=abc", wantErr: true},
+		{name: "unknown sort", query: "sort=sideways", wantErr: true},
+		{name: "garbage cursor", query: "cursor=!!!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery returned error: %v", err)
+			}
+			got, err := parsePageParams(query)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Limit != tt.wantLimit {
+				t.Fatalf("expected limit %d, got %d", tt.wantLimit, got.Limit)
+			}
+			if got.Desc != tt.wantDesc {
+				t.Fatalf("expected desc %v, got %v", tt.wantDesc, got.Desc)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/auth"
+	"github.com/IArtMediums/chirp_project/internal/logging"
+	"github.com/IArtMediums/chirp_project/internal/ratelimit"
+)
+
+// defaultRateLimit applies to every route without a policy of its own.
+const defaultRateLimit = "*"
+
+// defaultRateLimits are tighter on routes that are expensive or attractive
+// to abuse. RATE_LIMITS overrides them route by route.
+var defaultRateLimits = map[string]ratelimit.Policy{
+	defaultRateLimit: {Limit: 300, Window: time.Minute},
+	"POST /api/login": {Limit: 10, Window: time.Minute},
+	"POST /api/login/2fa": {Limit: 10, Window: time.Minute},
+	"POST /api/users": {Limit: 5, Window: time.Minute},
+	"POST /api/chirps": {Limit: 30, Window: time.Minute},
+	"POST /api/password-reset": {Limit: 5, Window: time.Minute},
+	"POST /api/verify-email/resend": {Limit: 5, Window: time.Minute},
+}
+
+// withRateLimitDefaults adds the default policies to overrides.
+func withRateLimitDefaults(overrides map[string]ratelimit.Policy) map[string]ratelimit.Policy {
+	policies := map[string]ratelimit.Policy{}
+	for route, p := range defaultRateLimits {
+		policies[route] = p
+	}
+	for route, p := range overrides {
+		policies[route] = p
+	}
+	return policies
+}
+
+// rateLimitKey identifies who a request counts against: the user, when it
+// carries a valid access token, and otherwise the client IP.
+func (a *apiConfig) rateLimitKey(r *http.Request) string {
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		if claims, err := a.jwtKeys.ParseJWT(token); err == nil {
+			if id, err := claims.UserID(); err == nil {
+				return "user:" + id.String()
+			}
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+// middlewareRateLimit wraps the whole mux so it can look up the route a
+// request will be served by and apply that route's policy. Each route has
+// its own buckets. Without a limiter every request is let through, and if
+// the store fails the request is let through too rather than taking the API
+// down with it.
+func (a *apiConfig) middlewareRateLimit(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		if a.rateLimiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		_, route := mux.Handler(r)
+		if route == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		policy, ok := a.rateLimits[route]
+		if !ok {
+			policy, ok = a.rateLimits[defaultRateLimit]
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		res, err := a.rateLimiter.Take(r.Context(), route + "|" + a.rateLimitKey(r), policy)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("rate limiter failed, letting request through", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+			respondWithError(w, 429, codeRateLimited, "too many requests, slow down", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
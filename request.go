@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/IArtMediums/chirp_project/internal/storage"
+	"github.com/lib/pq"
+)
+
+// pqUniqueViolation is the Postgres SQLSTATE for unique_violation.
+const pqUniqueViolation = "23505"
+
+// pqQueryCanceled is the Postgres SQLSTATE for a statement canceled on
+// request or by statement_timeout.
+const pqQueryCanceled = "57014"
+
+// decodeJSON decodes the request body into dst. When the body is missing or
+// malformed it writes a 400 that says what was wrong and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	err := json.NewDecoder(r.Body).Decode(dst)
+	if err == nil {
+		return true
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var message string
+	switch {
+	case errors.Is(err, io.EOF):
+		message = "request body is empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		message = "request body contains badly-formed JSON"
+	case errors.As(err, &syntaxErr):
+		message = fmt.Sprintf("request body contains badly-formed JSON (at position %d)", syntaxErr.Offset)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		message = fmt.Sprintf("field %q must be of type %s", typeErr.Field, typeErr.Type)
+	case errors.As(err, &typeErr):
+		message = fmt.Sprintf("request body must be a JSON %s", typeErr.Type)
+	default:
+		message = fmt.Sprintf("request body is invalid: %v", err)
+	}
+	respondWithError(w, 400, codeInvalidJSON, message, err)
+	return false
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation,
+// either from Postgres or from the in-memory store.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == pqUniqueViolation
+	}
+	return errors.Is(err, storage.ErrUniqueViolation)
+}
+
+// isTimeout reports whether err means a query ran out of time, either
+// because the request's deadline passed or because Postgres gave up on it.
+func isTimeout(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqQueryCanceled {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// isUnavailable reports whether err means the database could not be
+// reached or refused to take on more work.
+func isUnavailable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "53":
+			// connection_exception, insufficient_resources
+			return true
+		}
+		// admin_shutdown, cannot_connect_now
+		return pqErr.Code == "57P01" || pqErr.Code == "57P03"
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.As(err, &netErr)
+}
+
+// respondWithLookupError handles a failed single-row lookup: sql.ErrNoRows is
+// a 404 with code, anything else is a 500.
+func respondWithLookupError(w http.ResponseWriter, err error, code errorCode, message string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, code, message, err)
+		return
+	}
+	respondWithInternalError(w, err)
+}
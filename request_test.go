@@ -0,0 +1,32 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/IArtMediums/chirp_project/internal/storage"
+	"github.com/lib/pq"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "postgres unique", err: &pq.Error{Code: "23505"}, want: true},
+		{name: "wrapped postgres unique", err: fmt.Errorf("create user: %w", &pq.Error{Code: "23505"}), want: true},
+		{name: "postgres foreign key", err: &pq.Error{Code: "23503"}, want: false},
+		{name: "memory store", err: storage.ErrUniqueViolation, want: true},
+		{name: "no rows", err: sql.ErrNoRows, want: false},
+		{name: "nil", err: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUniqueViolation(tt.err); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
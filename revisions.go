@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/IArtMediums/chirp_project/internal/moderation"
+	"github.com/google/uuid"
+)
+
+func HandlerEditChirp(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	type request struct {
+		Body	string	`json:"body"`
+	}
+	chirp_id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", err)
+		return
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	ctx := r.Context()
+	chirp, err := cfg.dbQueries.GetChirp(ctx, chirp_id)
+	if err != nil {
+		respondWithLookupError(w, err, codeChirpNotFound, "chirp not found")
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", nil)
+		return
+	}
+	if chirp.UserID != id {
+		respondWithError(w, 403, codeNotOwner, "chirp belongs to another user", nil)
+		return
+	}
+	if !isChirpValid(req.Body) {
+		respondWithError(w, 400, codeChirpTooLong, "chirp is longer than 140 characters", nil)
+		return
+	}
+	moderated := cfg.moderation.Check(req.Body)
+	if moderated.Matched() && cfg.moderation.Mode() == moderation.ModeReject {
+		respondWithError(w, 400, codeChirpRejected, "chirp contains words that are not allowed", fmt.Errorf("chirp rejected by moderation: %v", moderated.Matches))
+		return
+	}
+	// Resubmitting the current body is a no-op rather than a new revision.
+	if moderated.Text != chirp.Body {
+		params := database.EditChirpParams{
+			ID: chirp.ID,
+			Body: moderated.Text,
+		}
+		chirp, err = cfg.dbQueries.EditChirp(ctx, params)
+		if err != nil {
+			respondWithLookupError(w, err, codeChirpNotFound, "chirp not found")
+			return
+		}
+		flagChirp(ctx, cfg, chirp.ID, moderated)
+	}
+	res := newChirpResponse(chirp)
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+func HandlerGetChirpRevisions(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type revision struct {
+		ID			uuid.UUID	`json:"id"`
+		Body		string		`json:"body"`
+		CreatedAt	time.Time	`json:"created_at"`
+	}
+	type response struct {
+		Revisions	[]revision	`json:"revisions"`
+	}
+	chirp_id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", err)
+		return
+	}
+	ctx := r.Context()
+	chirp, err := cfg.dbQueries.GetChirp(ctx, chirp_id)
+	if err != nil {
+		respondWithLookupError(w, err, codeChirpNotFound, "chirp not found")
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", nil)
+		return
+	}
+	revisions, err := cfg.dbQueries.ListChirpRevisions(ctx, chirp.ID)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	res := response{Revisions: []revision{}}
+	for _, rev := range revisions {
+		res.Revisions = append(res.Revisions, revision{
+			ID: rev.ID,
+			Body: rev.Body,
+			CreatedAt: rev.CreatedAt,
+		})
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
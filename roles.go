@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/auth"
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+type claimsKey struct{}
+
+func withClaims(r *http.Request, claims *auth.Claims) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsKey{}, claims)
+	if id, err := claims.UserID(); err == nil {
+		ctx = withRequestUser(ctx, id)
+	}
+	return r.WithContext(ctx)
+}
+
+// claimsFromRequest returns the access token claims stored by
+// middlewareAuthCfg. Requests that did not pass through it get empty claims,
+// which hold no scopes.
+func claimsFromRequest(r *http.Request) *auth.Claims {
+	if claims, ok := r.Context().Value(claimsKey{}).(*auth.Claims); ok {
+		return claims
+	}
+	return &auth.Claims{}
+}
+
+// HandlerSetUserRole changes a user's role. Tokens already issued keep their
+// old scopes until the user refreshes or logs in again, except for the admin
+// scope, which middlewareAdminCfg checks against the stored role.
+func HandlerSetUserRole(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type request struct {
+		Role	string	`json:"role"`
+	}
+	type response struct {
+		ID			uuid.UUID	`json:"id"`
+		Email		string		`json:"email"`
+		CreatedAt	time.Time	`json:"created_at"`
+		UpdatedAt	time.Time	`json:"updated_at"`
+		IsChirpyRed	bool		`json:"is_chirpy_red"`
+		Role		auth.Role	`json:"role"`
+	}
+	user_id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 404, codeUserNotFound, "user not found", err)
+		return
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		respondWithError(w, 400, codeInvalidRole, err.Error(), nil)
+		return
+	}
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByID(ctx, user_id)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	if err := recordAudit(ctx, r, cfg, "user.set_role", "user", user.ID.String(), req); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	params := database.SetUserRoleParams{
+		ID: user.ID,
+		Role: string(role),
+	}
+	updated, err := cfg.dbQueries.SetUserRole(ctx, params)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	res := response{
+		ID: updated.ID,
+		Email: updated.Email,
+		CreatedAt: updated.CreatedAt,
+		UpdatedAt: updated.UpdatedAt,
+		IsChirpyRed: updated.IsChirpyRed,
+		Role: auth.Role(updated.Role),
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
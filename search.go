@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/IArtMediums/chirp_project/internal/storage"
+	"github.com/google/uuid"
+)
+
+const maxSearchQueryLength = 256
+
+func HandlerSearchChirps(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type chirp struct {
+		chirpResponse
+		Rank		float32		`json:"rank"`
+		Snippet		string		`json:"snippet"`
+	}
+	type response struct {
+		Chirps		[]chirp		`json:"chirps"`
+		NextCursor	string		`json:"next_cursor,omitempty"`
+	}
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" || len(q) > maxSearchQueryLength {
+		respondWithError(w, 400, codeInvalidQuery, fmt.Sprintf("q is required and must be at most %d bytes", maxSearchQueryLength), fmt.Errorf("invalid search query: %q", q))
+		return
+	}
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(w, 400, codeInvalidQuery, err.Error(), err)
+		return
+	}
+	params := database.SearchChirpsParams{
+		Query: q,
+		Limit: int32(limit + 1),
+	}
+	if author_id := query.Get("author_id"); author_id != "" {
+		parsed, err := uuid.Parse(author_id)
+		if err != nil {
+			respondWithError(w, 400, codeInvalidQuery, "author_id must be a UUID", err)
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: parsed, Valid: true}
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := decodeSearchCursor(cursor)
+		if err != nil {
+			respondWithError(w, 400, codeInvalidQuery, err.Error(), err)
+			return
+		}
+		params.CursorRank = sql.NullFloat64{Float64: float64(c.Rank), Valid: true}
+		params.CursorCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: c.ID, Valid: true}
+	}
+	ctx := r.Context()
+	rows, err := cfg.dbQueries.SearchChirps(ctx, params)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	res := response{Chirps: []chirp{}}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		res.NextCursor = encodeSearchCursor(last.Rank, last.CreatedAt, last.ID)
+	}
+	for _, c := range rows {
+		res.Chirps = append(res.Chirps, chirp{
+			chirpResponse: newChirpResponse(database.Chirp{
+				ID: c.ID,
+				CreatedAt: c.CreatedAt,
+				UpdatedAt: c.UpdatedAt,
+				Body: c.Body,
+				UserID: c.UserID,
+				ReplyTo: c.ReplyTo,
+				ReplyCount: c.ReplyCount,
+				LikeCount: c.LikeCount,
+				RechirpCount: c.RechirpCount,
+				EditedAt: c.EditedAt,
+			}),
+			Rank: c.Rank,
+			Snippet: snippetHTML(c.Snippet),
+		})
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// snippetHTML escapes a search snippet and marks its matches with <mark>, so
+// markup a chirp contains comes back as text rather than as HTML.
+func snippetHTML(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, storage.HighlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, storage.HighlightStop, "</mark>")
+}
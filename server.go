@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/config"
+)
+
+const (
+	// readHeaderTimeout and readTimeout stop slow clients from holding
+	// connections open; request bodies here are small JSON documents.
+	readHeaderTimeout = 5 * time.Second
+	readTimeout = 15 * time.Second
+	idleTimeout = 2 * time.Minute
+	// writeTimeoutMargin is added to the longest request timeout, so that a
+	// handler that ran out of time can still send its 504.
+	writeTimeoutMargin = 5 * time.Second
+)
+
+// applyDBPool sizes db's connection pool. Zero means no limit, as it does
+// for sql.DB.
+func applyDBPool(db *sql.DB, settings *config.Config) {
+	db.SetMaxOpenConns(settings.DBMaxOpenConns)
+	db.SetMaxIdleConns(settings.DBMaxIdleConns)
+	db.SetConnMaxLifetime(settings.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(settings.DBConnMaxIdleTime)
+}
+
+// newServer returns the HTTP server for handler. Its write timeout outlasts
+// the longest request timeout, so requests are cut short by their own
+// deadlines, which answer properly, rather than by a dropped connection.
+func newServer(addr string, handler http.Handler, cfg *apiConfig) *http.Server {
+	longest := cfg.requestTimeout
+	for _, d := range cfg.routeTimeouts {
+		longest = max(longest, d)
+	}
+	return &http.Server{
+		Addr: addr,
+		Handler: handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout: readTimeout,
+		WriteTimeout: longest + writeTimeoutMargin,
+		IdleTimeout: idleTimeout,
+	}
+}
+
+// serve serves on ln until ctx is done, then stops accepting connections and
+// waits up to shutdownTimeout for in-flight requests to finish. It returns
+// nil after a clean shutdown.
+func serve(ctx context.Context, server *http.Server, ln net.Listener, shutdownTimeout time.Duration, logger *slog.Logger) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Serve(ln)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	logger.Info("shutting down, draining in-flight requests", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
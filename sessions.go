@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+// clientIP returns the host part of the request's remote address. Headers
+// such as X-Forwarded-For are ignored because nothing vouches for them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// HandlerListSessions lists the user's live logins. A session is a refresh
+// token family, so its id stays the same across rotations while the token
+// itself is never exposed.
+func HandlerListSessions(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	type session struct {
+		ID			uuid.UUID	`json:"id"`
+		CreatedAt	time.Time	`json:"created_at"`
+		LastUsedAt	time.Time	`json:"last_used_at"`
+		UserAgent	string		`json:"user_agent"`
+		IP			string		`json:"ip"`
+		ExpiresAt	time.Time	`json:"expires_at"`
+	}
+	type response struct {
+		Sessions	[]session	`json:"sessions"`
+	}
+	sessions, err := cfg.dbQueries.ListSessions(r.Context(), id)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	res := response{Sessions: []session{}}
+	for _, s := range sessions {
+		res.Sessions = append(res.Sessions, session{
+			ID: s.FamilyID,
+			CreatedAt: s.SessionStartedAt,
+			LastUsedAt: s.LastUsedAt,
+			UserAgent: s.UserAgent,
+			IP: s.IP,
+			ExpiresAt: s.ExpiresAt,
+		})
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+func HandlerRevokeSession(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	session_id, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, 404, codeSessionNotFound, "session not found", err)
+		return
+	}
+	params := database.RevokeSessionParams{
+		FamilyID: session_id,
+		UserID: id,
+	}
+	revoked, err := cfg.dbQueries.RevokeSession(r.Context(), params)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	// Another user's session looks exactly like a missing one.
+	if revoked == 0 {
+		respondWithError(w, 404, codeSessionNotFound, "session not found", nil)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// HandlerLogoutAll revokes every refresh token the user holds. Access tokens
+// already issued stay valid until they expire.
+func HandlerLogoutAll(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	if err := cfg.dbQueries.RevokeUserTokens(r.Context(), id); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
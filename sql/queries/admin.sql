@@ -0,0 +1,48 @@
+-- name: ListUsers :many
+SELECT * FROM users
+WHERE (sqlc.narg('email')::text IS NULL OR strpos(lower(email), lower(sqlc.narg('email')::text)) > 0)
+	AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+		OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: DisableUser :one
+UPDATE users
+SET disabled_at = COALESCE(disabled_at, NOW()),
+	updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: EnableUser :one
+UPDATE users
+SET disabled_at = NULL,
+	updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetChirpyRed :one
+UPDATE users
+SET is_chirpy_red = $2,
+	updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateAuditLogEntry :exec
+INSERT INTO admin_audit_log (id, created_at, actor_user_id, actor, action, target_type, target_id, details)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
+	);
+
+-- name: ListAuditLog :many
+SELECT * FROM admin_audit_log
+WHERE sqlc.narg('cursor_created_at')::timestamp IS NULL
+	OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
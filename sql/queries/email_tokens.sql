@@ -0,0 +1,42 @@
+-- name: CreateEmailToken :exec
+INSERT INTO email_tokens (token_hash, user_id, email, purpose, created_at, expires_at, used_at)
+VALUES (
+	sqlc.arg('token_hash'),
+	sqlc.arg('user_id'),
+	sqlc.arg('email'),
+	sqlc.arg('purpose'),
+	NOW(),
+	NOW() + make_interval(mins => sqlc.arg('ttl_minutes')::int),
+	NULL
+	);
+
+-- name: InvalidateEmailTokens :exec
+UPDATE email_tokens
+SET used_at = NOW()
+WHERE user_id = $1
+	AND purpose = $2
+	AND used_at IS NULL;
+
+-- name: ConsumeEmailToken :one
+UPDATE email_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+	AND purpose = $2
+	AND used_at IS NULL
+	AND expires_at > NOW()
+RETURNING user_id, email;
+
+-- name: VerifyUserEmail :execrows
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, NOW()),
+	updated_at = NOW()
+WHERE id = $1
+	AND email = $2;
+
+-- name: ResetUserPassword :execrows
+UPDATE users
+SET hashed_password = $3,
+	email_verified_at = COALESCE(email_verified_at, NOW()),
+	updated_at = NOW()
+WHERE id = $1
+	AND email = $2;
@@ -0,0 +1,39 @@
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+	$1,
+	$2,
+	NOW()
+	)
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1
+	AND followee_id = $2;
+
+-- name: ListFollowers :many
+SELECT follower_id, created_at FROM follows
+WHERE followee_id = sqlc.arg('user_id')
+	AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+		OR (created_at, follower_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, follower_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListFollowing :many
+SELECT followee_id, created_at FROM follows
+WHERE follower_id = sqlc.arg('user_id')
+	AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+		OR (created_at, followee_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, followee_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListTimeline :many
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg('user_id')
+	AND chirps.deleted_at IS NULL
+	AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+		OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,38 @@
+-- name: GetLoginLock :one
+SELECT locked_until
+FROM login_throttles
+WHERE ((scope = 'account' AND subject = sqlc.arg('email'))
+		OR (scope = 'ip' AND subject = sqlc.arg('ip')))
+	AND locked_until > NOW()
+ORDER BY locked_until DESC
+LIMIT 1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (scope, subject, failures, last_failure_at, locked_until)
+VALUES (sqlc.arg('scope'), sqlc.arg('subject'), 1, NOW(), NULL)
+ON CONFLICT (scope, subject) DO UPDATE
+SET failures = CASE
+		WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => sqlc.arg('window_seconds')::int) THEN 1
+		ELSE login_throttles.failures + 1
+	END,
+	last_failure_at = NOW()
+RETURNING failures;
+
+-- name: LockLogin :exec
+UPDATE login_throttles
+SET locked_until = NOW() + make_interval(secs => sqlc.arg('lock_seconds')::int)
+WHERE scope = sqlc.arg('scope')
+	AND subject = sqlc.arg('subject');
+
+-- name: ClearLoginFailures :exec
+DELETE FROM login_throttles
+WHERE scope = $1
+	AND subject = $2;
+
+-- name: ListLoginLocks :many
+SELECT login_throttles.scope, login_throttles.subject, login_throttles.failures, login_throttles.last_failure_at, login_throttles.locked_until, users.id AS user_id
+FROM login_throttles
+LEFT JOIN users ON login_throttles.scope = 'account'
+	AND users.email = login_throttles.subject
+WHERE login_throttles.locked_until > NOW()
+ORDER BY login_throttles.locked_until DESC, login_throttles.scope, login_throttles.subject;
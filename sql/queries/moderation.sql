@@ -0,0 +1,32 @@
+-- name: ListProfaneWords :many
+SELECT word FROM profane_words
+ORDER BY word ASC;
+
+-- name: AddProfaneWord :exec
+INSERT INTO profane_words (word, created_at)
+VALUES (
+	$1,
+	NOW()
+	)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveProfaneWord :exec
+DELETE FROM profane_words
+WHERE word = $1;
+
+-- name: CreateModerationFlag :one
+INSERT INTO moderation_flags (id, chirp_id, words, created_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	NOW()
+	)
+RETURNING *;
+
+-- name: ListModerationFlags :many
+SELECT * FROM moderation_flags
+WHERE sqlc.narg('cursor_created_at')::timestamp IS NULL
+	OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
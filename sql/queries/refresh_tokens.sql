@@ -0,0 +1,56 @@
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens
+WHERE token = $1;
+
+-- name: RotateRefreshToken :one
+WITH rotated AS (
+	UPDATE refresh_tokens
+	SET revoked_at = NOW(),
+		rotated_at = NOW(),
+		updated_at = NOW()
+	WHERE refresh_tokens.token = sqlc.arg('old_token')
+		AND refresh_tokens.revoked_at IS NULL
+		AND refresh_tokens.expires_at > NOW()
+	RETURNING refresh_tokens.user_id, refresh_tokens.family_id, refresh_tokens.session_started_at
+)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, session_started_at, user_agent, ip)
+SELECT sqlc.arg('new_token'), NOW(), NOW(), rotated.user_id, (NOW() + INTERVAL '60 days'), NULL,
+	rotated.family_id, rotated.session_started_at, sqlc.arg('user_agent'), sqlc.arg('ip')
+FROM rotated
+RETURNING *;
+
+-- name: RevokeTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+	updated_at = NOW()
+WHERE family_id = $1
+	AND revoked_at IS NULL;
+
+-- name: ListSessions :many
+SELECT family_id, session_started_at, created_at AS last_used_at, user_agent, ip, expires_at
+FROM refresh_tokens
+WHERE user_id = $1
+	AND revoked_at IS NULL
+	AND expires_at > NOW()
+ORDER BY created_at DESC, family_id DESC;
+
+-- name: CountActiveSessions :one
+SELECT COUNT(*) FROM refresh_tokens
+WHERE revoked_at IS NULL
+	AND expires_at > NOW();
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+	updated_at = NOW()
+WHERE family_id = $1
+	AND user_id = $2
+	AND revoked_at IS NULL
+	AND expires_at > NOW();
+
+-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+	updated_at = NOW()
+WHERE user_id = $1
+	AND revoked_at IS NULL;
@@ -0,0 +1,82 @@
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: SetUserTOTPSecret :execrows
+INSERT INTO user_totp (user_id, secret, created_at, enabled_at, last_counter)
+VALUES ($1, $2, NOW(), NULL, 0)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret,
+	created_at = NOW(),
+	enabled_at = NULL,
+	last_counter = 0
+WHERE user_totp.enabled_at IS NULL;
+
+-- name: EnableUserTOTP :execrows
+UPDATE user_totp
+SET enabled_at = NOW(),
+	last_counter = $2
+WHERE user_id = $1
+	AND enabled_at IS NULL;
+
+-- name: AdvanceTOTPCounter :execrows
+UPDATE user_totp
+SET last_counter = $2
+WHERE user_id = $1
+	AND enabled_at IS NOT NULL
+	AND last_counter < $2;
+
+-- name: DeleteUserTOTP :execrows
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCodes :exec
+INSERT INTO recovery_codes (user_id, code_hash, created_at, used_at)
+SELECT sqlc.arg('user_id')::uuid, unnest(sqlc.arg('code_hashes')::text[]), NOW(), NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1
+	AND code_hash = $2
+	AND used_at IS NULL;
+
+-- name: CountRecoveryCodes :one
+SELECT COUNT(*) FROM recovery_codes
+WHERE user_id = $1
+	AND used_at IS NULL;
+
+-- name: CreateLoginChallenge :exec
+INSERT INTO login_challenges (token_hash, user_id, created_at, expires_at, attempts, used_at)
+VALUES (
+	$1,
+	$2,
+	NOW(),
+	NOW() + INTERVAL '5 minutes',
+	0,
+	NULL
+	);
+
+-- name: GetLoginChallenge :one
+SELECT user_id FROM login_challenges
+WHERE token_hash = $1
+	AND used_at IS NULL
+	AND expires_at > NOW()
+	AND attempts < 5;
+
+-- name: FailLoginChallenge :exec
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1;
+
+-- name: ConsumeLoginChallenge :execrows
+UPDATE login_challenges
+SET used_at = NOW()
+WHERE token_hash = $1
+	AND used_at IS NULL
+	AND expires_at > NOW()
+	AND attempts < 5;
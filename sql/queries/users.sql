@@ -13,20 +13,17 @@ RETURNING id, created_at, updated_at, email, is_chirpy_red;
 DELETE FROM users;
 
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to)
 VALUES (
 	gen_random_uuid(),
 	NOW(),
 	NOW(),
 	$1,
-	$2
+	$2,
+	$3
 	)
 RETURNING *;
 
--- name: GetChirps :many
-SELECT * FROM chirps
-ORDER BY created_at ASC;
-
 -- name: GetChirp :one
 SELECT * FROM chirps
 WHERE id = $1;
@@ -36,23 +33,21 @@ SELECT * FROM users
 WHERE email = $1;
 
 -- name: CreateToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, session_started_at, user_agent, ip)
 VALUES (
 	$1,
 	NOW(),
 	NOW(),
 	$2,
 	(NOW() + INTERVAL '60 days'),
-	NULL
+	NULL,
+	$3,
+	NOW(),
+	$4,
+	$5
 	)
 RETURNING *;
 
--- name: GetUserFromRefreshToken :one
-SELECT user_id FROM refresh_tokens
-WHERE token = $1
-	AND revoked_at IS NULL
-	AND expires_at > NOW();
-
 -- name: RevokeToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(),
@@ -63,22 +58,100 @@ WHERE token = $1
 -- name: UpdateUserLogin :one
 UPDATE users
 SET updated_at = NOW(),
+	email_verified_at = CASE WHEN email = $1 THEN email_verified_at ELSE NULL END,
 	email = $1,
 	hashed_password = $2
 WHERE id = $3
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+RETURNING id, created_at, updated_at, email, is_chirpy_red, email_verified_at;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
 
+-- name: TombstoneChirp :exec
+WITH purged AS (
+	DELETE FROM chirp_revisions
+	WHERE chirp_id = $1
+)
+UPDATE chirps
+SET body = '',
+	deleted_at = NOW(),
+	updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors(id, reply_to, depth) AS (
+	SELECT parent.id, parent.reply_to, 1 FROM chirps AS parent
+	WHERE parent.id = (SELECT child.reply_to FROM chirps AS child WHERE child.id = $1)
+	UNION ALL
+	SELECT parent.id, parent.reply_to, ancestors.depth + 1 FROM chirps AS parent
+	JOIN ancestors ON parent.id = ancestors.reply_to
+)
+SELECT chirps.* FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants(id, depth) AS (
+	SELECT reply.id, 1 FROM chirps AS reply
+	WHERE reply.reply_to = sqlc.arg('id')
+	UNION ALL
+	SELECT reply.id, descendants.depth + 1 FROM chirps AS reply
+	JOIN descendants ON reply.reply_to = descendants.id
+	WHERE descendants.depth < sqlc.arg('max_depth')::int
+)
+SELECT chirps.* FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2,
+	updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role;
+
 -- name: UpgradeUser :exec
 UPDATE users
 SET is_chirpy_red = true,
 	updated_at = NOW()
 WHERE id = $1;
 
--- name: GetChirpsByAuthor :many
+-- name: ListChirpsAsc :many
 SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
+WHERE deleted_at IS NULL
+	AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+	AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+		OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+	AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+	AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+		OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirps :many
+SELECT id, created_at, updated_at, body, user_id, reply_to, reply_count, like_count, rechirp_count, edited_at, rank,
+	ts_headline('english', translate(body, U&'\E000\E001', ''), websearch_to_tsquery('english', sqlc.arg('query')),
+		U&'StartSel=\E000, StopSel=\E001, MaxFragments=2')::text AS snippet
+FROM (
+	SELECT chirps.*,
+		ts_rank(to_tsvector('english', body), websearch_to_tsquery('english', sqlc.arg('query'))) AS rank
+	FROM chirps
+	WHERE to_tsvector('english', body) @@ websearch_to_tsquery('english', sqlc.arg('query'))
+		AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+) AS ranked
+WHERE sqlc.narg('cursor_rank')::real IS NULL
+	OR (rank, created_at, id) < (sqlc.narg('cursor_rank')::real, sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
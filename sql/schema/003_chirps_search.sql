@@ -0,0 +1,6 @@
+-- +goose Up
+-- Search queries must spell the expression exactly as
+-- to_tsvector('english', body) to use the index.
+CREATE INDEX idx_chirps_body_search ON chirps USING GIN (to_tsvector('english', body));
+-- +goose Down
+DROP INDEX idx_chirps_body_search;
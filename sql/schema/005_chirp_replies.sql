@@ -0,0 +1,36 @@
+-- +goose Up
+ALTER TABLE chirps
+	ADD COLUMN reply_to UUID,
+	ADD COLUMN reply_count INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN deleted_at TIMESTAMP,
+	ADD CONSTRAINT fk_reply_to
+		FOREIGN KEY (reply_to)
+		REFERENCES chirps(id)
+		ON DELETE SET NULL;
+CREATE INDEX idx_chirps_reply_to ON chirps (reply_to);
+
+-- +goose StatementBegin
+CREATE FUNCTION chirps_update_reply_count() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP = 'INSERT' AND NEW.reply_to IS NOT NULL THEN
+		UPDATE chirps SET reply_count = reply_count + 1 WHERE id = NEW.reply_to;
+	ELSIF TG_OP = 'DELETE' AND OLD.reply_to IS NOT NULL THEN
+		UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.reply_to;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirps_reply_count
+	AFTER INSERT OR DELETE ON chirps
+	FOR EACH ROW EXECUTE FUNCTION chirps_update_reply_count();
+-- +goose Down
+DROP TRIGGER chirps_reply_count ON chirps;
+DROP FUNCTION chirps_update_reply_count();
+DROP INDEX idx_chirps_reply_to;
+ALTER TABLE chirps
+	DROP CONSTRAINT fk_reply_to,
+	DROP COLUMN deleted_at,
+	DROP COLUMN reply_count,
+	DROP COLUMN reply_to;
@@ -0,0 +1,79 @@
+-- +goose Up
+ALTER TABLE chirps
+	ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN rechirp_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE chirp_likes(
+	user_id UUID NOT NULL,
+	chirp_id UUID NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+
+	PRIMARY KEY (user_id, chirp_id),
+	CONSTRAINT fk_like_user
+		FOREIGN KEY (user_id)
+		REFERENCES users(id)
+		ON DELETE CASCADE,
+	CONSTRAINT fk_like_chirp
+		FOREIGN KEY (chirp_id)
+		REFERENCES chirps(id)
+		ON DELETE CASCADE
+);
+CREATE INDEX idx_chirp_likes_chirp_id ON chirp_likes (chirp_id);
+
+CREATE TABLE rechirps(
+	user_id UUID NOT NULL,
+	chirp_id UUID NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+
+	PRIMARY KEY (user_id, chirp_id),
+	CONSTRAINT fk_rechirp_user
+		FOREIGN KEY (user_id)
+		REFERENCES users(id)
+		ON DELETE CASCADE,
+	CONSTRAINT fk_rechirp_chirp
+		FOREIGN KEY (chirp_id)
+		REFERENCES chirps(id)
+		ON DELETE CASCADE
+);
+CREATE INDEX idx_rechirps_chirp_id ON rechirps (chirp_id);
+
+-- +goose StatementBegin
+CREATE FUNCTION chirps_update_like_count() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		UPDATE chirps SET like_count = like_count + 1 WHERE id = NEW.chirp_id;
+	ELSIF TG_OP = 'DELETE' THEN
+		UPDATE chirps SET like_count = like_count - 1 WHERE id = OLD.chirp_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION chirps_update_rechirp_count() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		UPDATE chirps SET rechirp_count = rechirp_count + 1 WHERE id = NEW.chirp_id;
+	ELSIF TG_OP = 'DELETE' THEN
+		UPDATE chirps SET rechirp_count = rechirp_count - 1 WHERE id = OLD.chirp_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirp_likes_count
+	AFTER INSERT OR DELETE ON chirp_likes
+	FOR EACH ROW EXECUTE FUNCTION chirps_update_like_count();
+CREATE TRIGGER rechirps_count
+	AFTER INSERT OR DELETE ON rechirps
+	FOR EACH ROW EXECUTE FUNCTION chirps_update_rechirp_count();
+-- +goose Down
+DROP TABLE rechirps;
+DROP TABLE chirp_likes;
+DROP FUNCTION chirps_update_rechirp_count();
+DROP FUNCTION chirps_update_like_count();
+ALTER TABLE chirps
+	DROP COLUMN rechirp_count,
+	DROP COLUMN like_count;
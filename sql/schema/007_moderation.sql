@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE profane_words(
+	word TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL
+);
+INSERT INTO profane_words (word, created_at)
+VALUES ('kerfuffle', NOW()), ('sharbert', NOW()), ('fornax', NOW());
+
+CREATE TABLE moderation_flags(
+	id UUID PRIMARY KEY,
+	chirp_id UUID NOT NULL,
+	words TEXT[] NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+
+	CONSTRAINT fk_flag_chirp
+		FOREIGN KEY (chirp_id)
+		REFERENCES chirps(id)
+		ON DELETE CASCADE
+);
+CREATE INDEX idx_moderation_flags_created_at_id ON moderation_flags (created_at, id);
+-- +goose Down
+DROP TABLE moderation_flags;
+DROP TABLE profane_words;
@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE chirps
+	ADD COLUMN edited_at TIMESTAMP;
+
+CREATE TABLE chirp_revisions(
+	id UUID PRIMARY KEY,
+	chirp_id UUID NOT NULL,
+	body TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+
+	CONSTRAINT fk_revision_chirp
+		FOREIGN KEY (chirp_id)
+		REFERENCES chirps(id)
+		ON DELETE CASCADE
+);
+CREATE INDEX idx_chirp_revisions_chirp_id ON chirp_revisions (chirp_id, created_at);
+-- +goose Down
+DROP TABLE chirp_revisions;
+ALTER TABLE chirps
+	DROP COLUMN edited_at;
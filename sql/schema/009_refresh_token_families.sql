@@ -0,0 +1,16 @@
+-- +goose Up
+-- Every refresh token belongs to a family that starts at login. Refreshing
+-- rotates the token within its family; rotated_at marks tokens that were
+-- replaced, so presenting one again is detectable as reuse.
+ALTER TABLE refresh_tokens
+	ADD COLUMN family_id UUID,
+	ADD COLUMN rotated_at TIMESTAMP;
+UPDATE refresh_tokens SET family_id = gen_random_uuid();
+ALTER TABLE refresh_tokens
+	ALTER COLUMN family_id SET NOT NULL;
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+-- +goose Down
+DROP INDEX idx_refresh_tokens_family_id;
+ALTER TABLE refresh_tokens
+	DROP COLUMN rotated_at,
+	DROP COLUMN family_id;
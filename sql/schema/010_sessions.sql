@@ -0,0 +1,18 @@
+-- +goose Up
+-- A session is a refresh token family. session_started_at, user_agent and ip
+-- are copied onto each rotated token so the active token describes the
+-- whole session.
+ALTER TABLE refresh_tokens
+	ADD COLUMN session_started_at TIMESTAMP,
+	ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+	ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+UPDATE refresh_tokens SET session_started_at = created_at;
+ALTER TABLE refresh_tokens
+	ALTER COLUMN session_started_at SET NOT NULL;
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+-- +goose Down
+DROP INDEX idx_refresh_tokens_user_id;
+ALTER TABLE refresh_tokens
+	DROP COLUMN ip,
+	DROP COLUMN user_agent,
+	DROP COLUMN session_started_at;
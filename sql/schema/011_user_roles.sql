@@ -0,0 +1,9 @@
+-- +goose Up
+-- Roles decide which scopes a user's access tokens carry. Admins change them
+-- through the admin API; everyone starts as a plain user.
+ALTER TABLE users
+	ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+	CHECK (role IN ('user', 'moderator', 'admin'));
+-- +goose Down
+ALTER TABLE users
+	DROP COLUMN role;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- Disabled users cannot log in or refresh. Every change made through the
+-- admin API is recorded in admin_audit_log; actor_user_id is NULL for
+-- actions taken with the ADMIN_KEY.
+ALTER TABLE users
+	ADD COLUMN disabled_at TIMESTAMP;
+
+CREATE TABLE admin_audit_log(
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	actor_user_id UUID,
+	actor TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target_id TEXT NOT NULL,
+	details JSONB NOT NULL DEFAULT '{}',
+
+	CONSTRAINT fk_audit_actor
+		FOREIGN KEY (actor_user_id)
+		REFERENCES users(id)
+		ON DELETE SET NULL
+);
+CREATE INDEX idx_admin_audit_log_created_at_id ON admin_audit_log (created_at, id);
+CREATE INDEX idx_users_created_at_id ON users (created_at, id);
+-- +goose Down
+DROP INDEX idx_users_created_at_id;
+DROP TABLE admin_audit_log;
+ALTER TABLE users
+	DROP COLUMN disabled_at;
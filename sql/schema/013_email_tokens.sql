@@ -0,0 +1,28 @@
+-- +goose Up
+-- New accounts must confirm their email before logging in; accounts that
+-- existed before verification was introduced count as verified. Email tokens
+-- are single use and stored only as SHA-256 hashes. A token is tied to the
+-- address it was sent to, so changing the email invalidates it.
+ALTER TABLE users
+	ADD COLUMN email_verified_at TIMESTAMP;
+UPDATE users SET email_verified_at = created_at;
+
+CREATE TABLE email_tokens(
+	token_hash TEXT PRIMARY KEY,
+	user_id UUID NOT NULL,
+	email TEXT NOT NULL,
+	purpose TEXT NOT NULL CHECK (purpose IN ('verify_email', 'password_reset')),
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+
+	CONSTRAINT fk_email_token_user
+		FOREIGN KEY (user_id)
+		REFERENCES users(id)
+		ON DELETE CASCADE
+);
+CREATE INDEX idx_email_tokens_user_id ON email_tokens (user_id);
+-- +goose Down
+DROP TABLE email_tokens;
+ALTER TABLE users
+	DROP COLUMN email_verified_at;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Failed logins are counted per account and per client IP. Account rows are
+-- keyed by the email that was tried, so unknown emails are throttled exactly
+-- like real ones. locked_until is set once a row runs out of free attempts.
+CREATE TABLE login_throttles(
+	scope TEXT NOT NULL CHECK (scope IN ('account', 'ip')),
+	subject TEXT NOT NULL,
+	failures INTEGER NOT NULL,
+	last_failure_at TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP,
+
+	PRIMARY KEY (scope, subject)
+);
+CREATE INDEX idx_login_throttles_locked_until ON login_throttles (locked_until);
+-- +goose Down
+DROP TABLE login_throttles;
@@ -0,0 +1,49 @@
+-- +goose Up
+-- user_totp holds a user's TOTP secret. enabled_at stays NULL until the user
+-- confirms enrollment with a code; last_counter is the time step of the last
+-- accepted code, so a code cannot be replayed. Recovery codes and login
+-- challenges are stored only as SHA-256 hashes.
+CREATE TABLE user_totp(
+	user_id UUID PRIMARY KEY,
+	secret TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	enabled_at TIMESTAMP,
+	last_counter BIGINT NOT NULL DEFAULT 0,
+
+	CONSTRAINT fk_totp_user
+		FOREIGN KEY (user_id)
+		REFERENCES users(id)
+		ON DELETE CASCADE
+);
+
+CREATE TABLE recovery_codes(
+	user_id UUID NOT NULL,
+	code_hash TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+
+	PRIMARY KEY (user_id, code_hash),
+	CONSTRAINT fk_recovery_code_totp
+		FOREIGN KEY (user_id)
+		REFERENCES user_totp(user_id)
+		ON DELETE CASCADE
+);
+
+CREATE TABLE login_challenges(
+	token_hash TEXT PRIMARY KEY,
+	user_id UUID NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	used_at TIMESTAMP,
+
+	CONSTRAINT fk_login_challenge_user
+		FOREIGN KEY (user_id)
+		REFERENCES users(id)
+		ON DELETE CASCADE
+);
+CREATE INDEX idx_login_challenges_user_id ON login_challenges (user_id);
+-- +goose Down
+DROP TABLE login_challenges;
+DROP TABLE recovery_codes;
+DROP TABLE user_totp;
@@ -0,0 +1,8 @@
+// Package schema embeds the goose migrations in this directory, so the
+// server binary can apply them itself; see internal/migrate.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var Migrations embed.FS
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxThreadDepth = 50
+const maxThreadReplies = 500
+
+type threadNode struct {
+	chirpResponse
+	Replies		[]threadNode	`json:"replies"`
+}
+
+func HandlerGetChirpThread(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type response struct {
+		Ancestors	[]chirpResponse	`json:"ancestors"`
+		Chirp		chirpResponse	`json:"chirp"`
+		Replies		[]threadNode	`json:"replies"`
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 404, codeChirpNotFound, "chirp not found", err)
+		return
+	}
+	ctx := r.Context()
+	chirp, err := cfg.dbQueries.GetChirp(ctx, id)
+	if err != nil {
+		respondWithLookupError(w, err, codeChirpNotFound, "chirp not found")
+		return
+	}
+	ancestors, err := cfg.dbQueries.GetChirpAncestors(ctx, id)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	descendants, err := cfg.dbQueries.GetChirpDescendants(ctx, database.GetChirpDescendantsParams{
+		ID: id,
+		MaxDepth: maxThreadDepth,
+		Limit: maxThreadReplies,
+	})
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	res := response{
+		Ancestors: []chirpResponse{},
+		Chirp: newChirpResponse(chirp),
+		Replies: buildReplyTree(id, descendants),
+	}
+	for _, c := range ancestors {
+		res.Ancestors = append(res.Ancestors, newChirpResponse(c))
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// buildReplyTree nests descendants under their parents, keeping the oldest
+// reply first at every level. descendants must already be in that order.
+func buildReplyTree(root uuid.UUID, descendants []database.Chirp) []threadNode {
+	children := map[uuid.UUID][]database.Chirp{}
+	for _, c := range descendants {
+		children[c.ReplyTo.UUID] = append(children[c.ReplyTo.UUID], c)
+	}
+	var build func(parent uuid.UUID) []threadNode
+	build = func(parent uuid.UUID) []threadNode {
+		nodes := []threadNode{}
+		for _, c := range children[parent] {
+			nodes = append(nodes, threadNode{
+				chirpResponse: newChirpResponse(c),
+				Replies: build(c.ID),
+			})
+		}
+		return nodes
+	}
+	return build(root)
+}
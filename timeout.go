@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// backgroundTimeout bounds work that has to finish even when the request
+// that started it is canceled or out of time; see detachedContext.
+const backgroundTimeout = 5 * time.Second
+
+// defaultRouteTimeouts are shorter on routes whose queries can get slow, so
+// that a burst of them gives up early instead of tying up the database.
+// ROUTE_TIMEOUTS overrides them route by route.
+var defaultRouteTimeouts = map[string]time.Duration{
+	"GET /api/chirps/search": 5 * time.Second,
+	"GET /api/chirps/{chirpID}/thread": 5 * time.Second,
+}
+
+// withRouteTimeoutDefaults adds the default route timeouts to overrides.
+func withRouteTimeoutDefaults(overrides map[string]time.Duration) map[string]time.Duration {
+	routes := map[string]time.Duration{}
+	for route, d := range defaultRouteTimeouts {
+		routes[route] = d
+	}
+	for route, d := range overrides {
+		routes[route] = d
+	}
+	return routes
+}
+
+// middlewareTimeout gives every request a deadline: its route's timeout, or
+// the overall request timeout. Handlers pass r.Context() to the database and
+// everything else that waits, so once the deadline passes their calls fail
+// and respondWithInternalError answers 504. Without a timeout configured
+// requests only end when the client goes away.
+func (a *apiConfig) middlewareTimeout(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		timeout, ok := a.routeTimeouts[routePattern(mux, r)]
+		if !ok {
+			timeout = a.requestTimeout
+		}
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// detachedContext is for work that must not be cut short once it has begun,
+// even if the client hangs up or the request runs out of time: counting a
+// failed login, revoking a leaked token family, writing the audit log. It
+// keeps ctx's values, such as the request logger.
+func detachedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), backgroundTimeout)
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/IArtMediums/chirp_project/internal/auth"
+	"github.com/IArtMediums/chirp_project/internal/database"
+	"github.com/google/uuid"
+)
+
+const totpIssuer = "Chirpy"
+
+func twoFactorEnabled(ctx context.Context, cfg *apiConfig, userID uuid.UUID) (bool, error) {
+	totp, err := cfg.dbQueries.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.EnabledAt.Valid, nil
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused
+// recovery code. Either is spent by a successful check, so it cannot be
+// used again.
+func checkSecondFactor(ctx context.Context, cfg *apiConfig, userID uuid.UUID, code string) (bool, error) {
+	totp, err := cfg.dbQueries.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !totp.EnabledAt.Valid {
+		return false, nil
+	}
+	if counter, ok := auth.ValidateTOTP(totp.Secret, code, time.Now(), totp.LastCounter); ok {
+		params := database.AdvanceTOTPCounterParams{
+			UserID: userID,
+			LastCounter: counter,
+		}
+		// 0 rows means another request used this code first.
+		advanced, err := cfg.dbQueries.AdvanceTOTPCounter(ctx, params)
+		return advanced == 1, err
+	}
+	params := database.UseRecoveryCodeParams{
+		UserID: userID,
+		CodeHash: auth.HashRecoveryCode(code),
+	}
+	used, err := cfg.dbQueries.UseRecoveryCode(ctx, params)
+	return used == 1, err
+}
+
+// checkAccountSecondFactor checks the code a logged-in user gives to change
+// their two-factor settings. Wrong codes count towards the same lockout as
+// wrong passwords and wrong codes at login, so a stolen access token cannot
+// be used to guess its way past the second factor. It writes the response
+// and reports false unless the code is right.
+func checkAccountSecondFactor(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID, code string) bool {
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByID(ctx, id)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return false
+	}
+	ip := clientIP(r)
+	until, locked, err := loginLockedUntil(ctx, cfg, user.Email, ip)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return false
+	}
+	if locked {
+		respondWithLoginLocked(w, until)
+		return false
+	}
+	ok, err := checkSecondFactor(ctx, cfg, id, code)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return false
+	}
+	if !ok {
+		if err := recordLoginFailure(ctx, cfg, user.Email, ip); err != nil {
+			respondWithInternalError(w, err)
+			return false
+		}
+		respondWithError(w, 400, codeInvalidTwoFactorCode, "incorrect two-factor code", nil)
+		return false
+	}
+	return true
+}
+
+// newRecoveryCodes replaces the user's recovery codes with a fresh set and
+// returns them. This is the only time they are shown.
+func newRecoveryCodes(ctx context.Context, cfg *apiConfig, userID uuid.UUID) ([]string, error) {
+	codes, hashes := auth.MakeRecoveryCodes()
+	if err := cfg.dbQueries.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+	params := database.CreateRecoveryCodesParams{
+		UserID: userID,
+		CodeHashes: hashes,
+	}
+	if err := cfg.dbQueries.CreateRecoveryCodes(ctx, params); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func respondWithRecoveryCodes(w http.ResponseWriter, codes []string) {
+	type response struct {
+		RecoveryCodes	[]string	`json:"recovery_codes"`
+	}
+	data, err := json.Marshal(&response{RecoveryCodes: codes})
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// respondWithLoginChallenge answers a correct password for a user with
+// two-factor authentication. The challenge token is good for 5 minutes and
+// 5 wrong codes.
+func respondWithLoginChallenge(w http.ResponseWriter, r *http.Request, cfg *apiConfig, userID uuid.UUID) {
+	type response struct {
+		TwoFactorRequired	bool	`json:"two_factor_required"`
+		ChallengeToken		string	`json:"challenge_token"`
+	}
+	token, hash := auth.MakeLoginChallenge()
+	params := database.CreateLoginChallengeParams{
+		TokenHash: hash,
+		UserID: userID,
+	}
+	if err := cfg.dbQueries.CreateLoginChallenge(r.Context(), params); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	data, err := json.Marshal(&response{TwoFactorRequired: true, ChallengeToken: token})
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// HandlerLoginTwoFactor is the second login step: it trades a challenge token
+// and a TOTP or recovery code for access and refresh tokens. Wrong codes
+// count towards the same lockout as wrong passwords.
+func HandlerLoginTwoFactor(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	type request struct {
+		ChallengeToken	string	`json:"challenge_token"`
+		Code			string	`json:"code"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	ctx := r.Context()
+	hash := auth.HashLoginChallenge(req.ChallengeToken)
+	user_id, err := cfg.dbQueries.GetLoginChallenge(ctx, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 401, codeInvalidChallenge, "challenge token is invalid or expired, log in again", err)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(ctx, user_id)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	ip := clientIP(r)
+	until, locked, err := loginLockedUntil(ctx, cfg, user.Email, ip)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if locked {
+		respondWithLoginLocked(w, until)
+		return
+	}
+	ok, err := checkSecondFactor(ctx, cfg, user.ID, req.Code)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if !ok {
+		if err := cfg.dbQueries.FailLoginChallenge(ctx, hash); err != nil {
+			respondWithInternalError(w, err)
+			return
+		}
+		if err := recordLoginFailure(ctx, cfg, user.Email, ip); err != nil {
+			respondWithInternalError(w, err)
+			return
+		}
+		respondWithError(w, 401, codeInvalidTwoFactorCode, "incorrect two-factor code", nil)
+		return
+	}
+	consumed, err := cfg.dbQueries.ConsumeLoginChallenge(ctx, hash)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if consumed == 0 {
+		respondWithError(w, 401, codeInvalidChallenge, "challenge token is invalid or expired, log in again", nil)
+		return
+	}
+	if err := clearAccountLock(ctx, cfg, user.Email); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	// The account may have been disabled since the password step.
+	if user.DisabledAt.Valid {
+		respondWithError(w, 403, codeAccountDisabled, "account is disabled", nil)
+		return
+	}
+	respondWithLogin(w, r, cfg, user)
+}
+
+func HandlerTwoFactorStatus(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	type response struct {
+		Enabled					bool	`json:"enabled"`
+		RecoveryCodesRemaining	int64	`json:"recovery_codes_remaining"`
+	}
+	ctx := r.Context()
+	enabled, err := twoFactorEnabled(ctx, cfg, id)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	res := response{Enabled: enabled}
+	if enabled {
+		res.RecoveryCodesRemaining, err = cfg.dbQueries.CountRecoveryCodes(ctx, id)
+		if err != nil {
+			respondWithInternalError(w, err)
+			return
+		}
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// HandlerTwoFactorSetup starts enrollment with a new secret. Calling it again
+// before confirming replaces the secret.
+func HandlerTwoFactorSetup(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	type response struct {
+		Secret		string	`json:"secret"`
+		OtpauthURI	string	`json:"otpauth_uri"`
+	}
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByID(ctx, id)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	secret := auth.NewTOTPSecret()
+	params := database.SetUserTOTPSecretParams{
+		UserID: user.ID,
+		Secret: secret,
+	}
+	set, err := cfg.dbQueries.SetUserTOTPSecret(ctx, params)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if set == 0 {
+		respondWithError(w, 409, codeTwoFactorEnabled, "two-factor authentication is already enabled", nil)
+		return
+	}
+	res := response{
+		Secret: secret,
+		OtpauthURI: auth.TOTPURI(totpIssuer, user.Email, secret),
+	}
+	data, err := json.Marshal(&res)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// HandlerTwoFactorConfirm finishes enrollment once the user proves their
+// authenticator works, and returns their first set of recovery codes.
+func HandlerTwoFactorConfirm(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	type request struct {
+		Code	string	`json:"code"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	ctx := r.Context()
+	totp, err := cfg.dbQueries.GetUserTOTP(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 400, codeTwoFactorNotSetUp, "call POST /api/users/2fa/setup first", err)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if totp.EnabledAt.Valid {
+		respondWithError(w, 409, codeTwoFactorEnabled, "two-factor authentication is already enabled", nil)
+		return
+	}
+	counter, ok := auth.ValidateTOTP(totp.Secret, req.Code, time.Now(), 0)
+	if !ok {
+		respondWithError(w, 400, codeInvalidTwoFactorCode, "incorrect two-factor code", nil)
+		return
+	}
+	params := database.EnableUserTOTPParams{
+		UserID: id,
+		LastCounter: counter,
+	}
+	enabled, err := cfg.dbQueries.EnableUserTOTP(ctx, params)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if enabled == 0 {
+		respondWithError(w, 409, codeTwoFactorEnabled, "two-factor authentication is already enabled", nil)
+		return
+	}
+	codes, err := newRecoveryCodes(ctx, cfg, id)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	respondWithRecoveryCodes(w, codes)
+}
+
+// HandlerTwoFactorRecoveryCodes replaces the user's recovery codes. Like
+// disabling, it needs a current code, so a stolen access token alone is not
+// enough; wrong codes lock the account as at login.
+func HandlerTwoFactorRecoveryCodes(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	type request struct {
+		Code	string	`json:"code"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !checkAccountSecondFactor(w, r, cfg, id, req.Code) {
+		return
+	}
+	ctx := r.Context()
+	codes, err := newRecoveryCodes(ctx, cfg, id)
+	if err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	respondWithRecoveryCodes(w, codes)
+}
+
+func HandlerTwoFactorDisable(w http.ResponseWriter, r *http.Request, cfg *apiConfig, id uuid.UUID) {
+	type request struct {
+		Code	string	`json:"code"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !checkAccountSecondFactor(w, r, cfg, id, req.Code) {
+		return
+	}
+	ctx := r.Context()
+	if _, err := cfg.dbQueries.DeleteUserTOTP(ctx, id); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// HandlerAdminResetTwoFactor turns off two-factor authentication for a user
+// who has lost both their authenticator and their recovery codes.
+func HandlerAdminResetTwoFactor(w http.ResponseWriter, r *http.Request, cfg *apiConfig) {
+	user_id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 404, codeUserNotFound, "user not found", err)
+		return
+	}
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByID(ctx, user_id)
+	if err != nil {
+		respondWithLookupError(w, err, codeUserNotFound, "user not found")
+		return
+	}
+	if err := recordAudit(ctx, r, cfg, "user.reset_2fa", "user", user.ID.String(), nil); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	if _, err := cfg.dbQueries.DeleteUserTOTP(ctx, user.ID); err != nil {
+		respondWithInternalError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}